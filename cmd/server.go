@@ -1,30 +1,75 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"time"
 
 	_ "net/http/pprof"
 
+	"github.com/mkauppila/mud/internal/config"
 	"github.com/mkauppila/mud/internal/game"
 	"github.com/mkauppila/mud/internal/server"
+	"golang.org/x/crypto/ssh"
 )
 
+const shutdownTimeout = 10 * time.Second
 
-func setupPprof(host string, port int16) {
-	fmt.Printf("Start pprof at %s:%d\n", host, port)
+func setupPprof(address string) {
+	fmt.Printf("Start pprof at %s\n", address)
 
 	// pprof is by default added to DefaultServerMux
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), nil)
-	// err := http.ListenAndServe("localhost:5000", nil)
+	err := http.ListenAndServe(address, nil)
 	if err != nil {
 		panic(err)
 	}
 }
 
 func main() {
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	areas := game.DefaultAreas()
+	if cfg.WorldDir != "" {
+		areas, err = game.LoadAreas(os.DirFS(cfg.WorldDir))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS {
+		tlsConfig, err = cfg.TLSConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	var sshHostKey ssh.Signer
+	if cfg.SSH {
+		sshHostKey, err = server.LoadOrCreateHostKey(cfg.SSHHostKeyPath())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
 	exitC := make(chan struct{})
 
 	signals := make(chan os.Signal, 1)
@@ -36,17 +81,62 @@ func main() {
 		}
 	}()
 
-	world := game.NewWorld()
-	server := server.NewServer(server.UuidGenerator, world)
+	accountStore, err := game.NewFileAccountStore(filepath.Join(cfg.DataDir, "accounts"))
+	if err != nil {
+		panic(err)
+	}
+
+	characterStore, err := game.NewFileCharacterStore(filepath.Join(cfg.DataDir, "characters"))
+	if err != nil {
+		panic(err)
+	}
+
+	world := game.NewWorld(
+		game.WithAccountStore(accountStore),
+		game.WithCharacterStore(characterStore),
+		game.WithAutosaveInterval(cfg.AutosaveInterval.Duration),
+		game.WithAreas(areas),
+		game.WithTimeStep(cfg.TickRate.Duration),
+	)
+	var sshConfig *ssh.ServerConfig
+	if sshHostKey != nil {
+		sshConfig = server.NewSSHConfig(sshHostKey, world.LoadAccount)
+	}
+	server := server.NewServer(
+		server.UuidGenerator,
+		world,
+		server.WithAddress(cfg.Listen),
+		server.WithMaxConnections(cfg.MaxConnections),
+		server.WithIdleTimeout(cfg.IdleTimeout.Duration),
+		server.WithOutputOptions(cfg.OutputOptions()),
+		server.WithAllowedOrigins(cfg.AllowedOrigins()...),
+	)
 	go server.StartAcceptingConnections()
+	if tlsConfig != nil {
+		go server.StartTLSListener(cfg.TLSListen, tlsConfig)
+	}
+	if sshConfig != nil {
+		go server.StartSSHListener(cfg.SSHListen, sshConfig)
+	}
+	if cfg.Web {
+		go server.StartWebServer(cfg.WebListen)
+	}
 	go world.RunGameLoop()
 
-	go setupPprof("localhost", 8000)
+	if cfg.Pprof {
+		// the queue depths are shown at /debug/vars next to pprof
+		expvar.Publish("outputQueueDepths", expvar.Func(func() interface{} {
+			return server.QueueDepths()
+		}))
+		go setupPprof(cfg.PprofListen)
+	}
 
 	<-exitC
 
-	// server.Disconnect()
-	// for _, client := range clients {
-	// 	client.Disconnect()
-	// }
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Println("Shutdown failed: ", err)
+	}
+	world.Stop()
 }
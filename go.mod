@@ -2,4 +2,7 @@ module github.com/mkauppila/mud
 
 go 1.17
 
-require github.com/google/uuid v1.3.0
+require (
+	github.com/google/uuid v1.3.0
+	golang.org/x/crypto v0.8.0
+)
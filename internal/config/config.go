@@ -0,0 +1,291 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mkauppila/mud/internal/game"
+	"github.com/mkauppila/mud/internal/server"
+)
+
+// Duration is a time.Duration written as "1s" or "5m" in the config file
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Config is the configuration of the server. It's read from the config
+// file, the environment and the command line flags, the latter overriding
+// the former.
+type Config struct {
+	Listen           string   `json:"listen"`
+	TickRate         Duration `json:"tickRate"`
+	WorldDir         string   `json:"worldDir"`
+	DataDir          string   `json:"dataDir"`
+	AutosaveInterval Duration `json:"autosaveInterval"`
+	MaxConnections   int      `json:"maxConnections"`
+	IdleTimeout      Duration `json:"idleTimeout"`
+	OutputQueueSize  int      `json:"outputQueueSize"`
+	SlowClientPolicy string   `json:"slowClientPolicy"`
+	WriteTimeout     Duration `json:"writeTimeout"`
+	TLS              bool     `json:"tls"`
+	TLSListen        string   `json:"tlsListen"`
+	TLSCert          string   `json:"tlsCert"`
+	TLSKey           string   `json:"tlsKey"`
+	TLSSelfSigned    bool     `json:"tlsSelfSigned"`
+	SSH              bool     `json:"ssh"`
+	SSHListen        string   `json:"sshListen"`
+	SSHHostKey       string   `json:"sshHostKey"`
+	Web              bool     `json:"web"`
+	WebListen        string   `json:"webListen"`
+	WebOrigins       string   `json:"webOrigins"`
+	Pprof            bool     `json:"pprof"`
+	PprofListen      string   `json:"pprofListen"`
+}
+
+func Default() Config {
+	output := server.DefaultOutputOptions()
+	return Config{
+		Listen:           server.DefaultAddress,
+		TickRate:         Duration{game.DefaultTimeStep},
+		DataDir:          "data",
+		AutosaveInterval: Duration{game.DefaultAutosaveInterval},
+		IdleTimeout:      Duration{30 * time.Minute},
+		OutputQueueSize:  output.QueueSize,
+		SlowClientPolicy: output.Policy.String(),
+		WriteTimeout:     Duration{output.WriteTimeout},
+		TLSListen:        "localhost:6443",
+		SSHListen:        "localhost:6022",
+		WebListen:        "localhost:6080",
+		PprofListen:      "localhost:8000",
+	}
+}
+
+// newFlagSet binds the flags to the config. The same flags are used for
+// reading the environment.
+func newFlagSet(c *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address the server listens at")
+	fs.DurationVar(&c.TickRate.Duration, "tick", c.TickRate.Duration, "how often the world is updated")
+	fs.StringVar(&c.WorldDir, "world", c.WorldDir, "directory of the area files, defaults to the embedded areas")
+	fs.StringVar(&c.DataDir, "data", c.DataDir, "directory of the accounts and characters")
+	fs.DurationVar(&c.AutosaveInterval.Duration, "autosave", c.AutosaveInterval.Duration, "how often the characters are saved, 0 disables")
+	fs.IntVar(&c.MaxConnections, "max-connections", c.MaxConnections, "most clients connected at once, 0 is unlimited")
+	fs.DurationVar(&c.IdleTimeout.Duration, "idle-timeout", c.IdleTimeout.Duration, "disconnect clients which send nothing for this long, 0 disables")
+	fs.IntVar(&c.OutputQueueSize, "output-queue", c.OutputQueueSize, "messages queued for a client before the slow client policy is used")
+	fs.StringVar(&c.SlowClientPolicy, "slow-client-policy", c.SlowClientPolicy, "drop-oldest, coalesce or disconnect")
+	fs.DurationVar(&c.WriteTimeout.Duration, "write-timeout", c.WriteTimeout.Duration, "disconnect clients whose write takes longer, 0 disables")
+	fs.BoolVar(&c.TLS, "tls", c.TLS, "accept telnet over TLS next to the plain listener")
+	fs.StringVar(&c.TLSListen, "tls-listen", c.TLSListen, "address the TLS listener listens at")
+	fs.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "PEM file of the TLS certificate")
+	fs.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "PEM file of the TLS certificate's key")
+	fs.BoolVar(&c.TLSSelfSigned, "tls-self-signed", c.TLSSelfSigned, "generate a self-signed certificate for development")
+	fs.BoolVar(&c.SSH, "ssh", c.SSH, "accept SSH sessions logging in with the account credentials")
+	fs.StringVar(&c.SSHListen, "ssh-listen", c.SSHListen, "address the SSH listener listens at")
+	fs.StringVar(&c.SSHHostKey, "ssh-host-key", c.SSHHostKey, "file of the SSH host key, generated if missing, defaults to ssh_host_key in the data directory")
+	fs.BoolVar(&c.Web, "web", c.Web, "serve the web client and the WebSocket")
+	fs.StringVar(&c.WebListen, "web-listen", c.WebListen, "address the web client is served at")
+	fs.StringVar(&c.WebOrigins, "web-origins", c.WebOrigins, "comma separated origins of the other pages which may use the WebSocket")
+	fs.BoolVar(&c.Pprof, "pprof", c.Pprof, "serve pprof and the expvars")
+	fs.StringVar(&c.PprofListen, "pprof-listen", c.PprofListen, "address pprof listens at")
+	return fs
+}
+
+// EnvName is the environment variable of the flag, e.g. MUD_MAX_CONNECTIONS
+func EnvName(flagName string) string {
+	return "MUD_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Load reads the config file given with -config, then the environment and
+// then the rest of the flags. The result is validated.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	flags := Default()
+	fs := newFlagSet(&flags)
+	path := fs.String("config", "", "JSON config file")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	c := Default()
+	if *path != "" {
+		if err := readFile(*path, &c); err != nil {
+			return Config{}, err
+		}
+	}
+
+	settings := newFlagSet(&c)
+	var err error
+	settings.VisitAll(func(f *flag.Flag) {
+		if value, ok := lookupEnv(EnvName(f.Name)); ok && err == nil {
+			if setErr := settings.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("%s: %w", EnvName(f.Name), setErr)
+			}
+		}
+	})
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && err == nil {
+			err = settings.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	return c, c.Validate()
+}
+
+func readFile(path string, c *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+type ErrInvalidConfig struct {
+	setting string
+	reason  string
+}
+
+func (e ErrInvalidConfig) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.setting, e.reason)
+}
+
+func (c Config) Validate() error {
+	if err := validateAddress("listen", c.Listen); err != nil {
+		return err
+	}
+	if c.TLS {
+		if err := validateAddress("tlsListen", c.TLSListen); err != nil {
+			return err
+		}
+		if !c.TLSSelfSigned && (c.TLSCert == "" || c.TLSKey == "") {
+			return ErrInvalidConfig{setting: "tlsCert", reason: "the certificate and the key are needed unless self-signed"}
+		}
+	}
+	if c.SSH {
+		if err := validateAddress("sshListen", c.SSHListen); err != nil {
+			return err
+		}
+	}
+	if c.Web {
+		if err := validateAddress("webListen", c.WebListen); err != nil {
+			return err
+		}
+	}
+	if c.Pprof {
+		if err := validateAddress("pprofListen", c.PprofListen); err != nil {
+			return err
+		}
+	}
+	if c.TickRate.Duration <= 0 {
+		return ErrInvalidConfig{setting: "tickRate", reason: "must be positive"}
+	}
+	if c.DataDir == "" {
+		return ErrInvalidConfig{setting: "dataDir", reason: "must be given"}
+	}
+	if c.AutosaveInterval.Duration < 0 {
+		return ErrInvalidConfig{setting: "autosaveInterval", reason: "can't be negative"}
+	}
+	if c.MaxConnections < 0 {
+		return ErrInvalidConfig{setting: "maxConnections", reason: "can't be negative"}
+	}
+	if c.IdleTimeout.Duration < 0 {
+		return ErrInvalidConfig{setting: "idleTimeout", reason: "can't be negative"}
+	}
+	if c.OutputQueueSize < 1 {
+		return ErrInvalidConfig{setting: "outputQueueSize", reason: "must be at least 1"}
+	}
+	if _, err := server.ParseSlowClientPolicy(c.SlowClientPolicy); err != nil {
+		return ErrInvalidConfig{setting: "slowClientPolicy", reason: err.Error()}
+	}
+	if c.WriteTimeout.Duration < 0 {
+		return ErrInvalidConfig{setting: "writeTimeout", reason: "can't be negative"}
+	}
+	return nil
+}
+
+func validateAddress(setting, address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return ErrInvalidConfig{setting: setting, reason: err.Error()}
+	}
+	return nil
+}
+
+// TLSConfig loads the certificate or generates a self-signed one for the
+// host of the TLS listener
+func (c Config) TLSConfig() (*tls.Config, error) {
+	if !c.TLSSelfSigned {
+		return server.LoadTLSConfig(c.TLSCert, c.TLSKey)
+	}
+	host, _, err := net.SplitHostPort(c.TLSListen)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{"localhost"}
+	if host != "" && host != "localhost" {
+		hosts = append(hosts, host)
+	}
+	return server.SelfSignedTLSConfig(hosts...)
+}
+
+// AllowedOrigins are the other origins whose pages may use the WebSocket
+func (c Config) AllowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(c.WebOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// SSHHostKeyPath is the file of the SSH host key
+func (c Config) SSHHostKeyPath() string {
+	if c.SSHHostKey != "" {
+		return c.SSHHostKey
+	}
+	return filepath.Join(c.DataDir, "ssh_host_key")
+}
+
+// OutputOptions are the clients' output options of the config
+func (c Config) OutputOptions() server.OutputOptions {
+	policy, _ := server.ParseSlowClientPolicy(c.SlowClientPolicy)
+	return server.OutputOptions{
+		QueueSize:    c.OutputQueueSize,
+		Policy:       policy,
+		WriteTimeout: c.WriteTimeout.Duration,
+	}
+}
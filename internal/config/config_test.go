@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envOf(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	c, err := Load(nil, envOf(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != Default() {
+		t.Fatalf("Got %+v, expected the defaults", c)
+	}
+}
+
+func TestFlagsOverrideEnvOverridesFile(t *testing.T) {
+	path := writeConfigFile(t, `{"listen": "0.0.0.0:7000", "tickRate": "500ms", "maxConnections": 10, "dataDir": "/var/mud"}`)
+	env := map[string]string{
+		"MUD_MAX_CONNECTIONS": "20",
+		"MUD_TICK":            "250ms",
+	}
+
+	c, err := Load([]string{"-config", path, "-tick", "100ms"}, envOf(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		setting string
+		got     interface{}
+		want    interface{}
+	}{
+		{setting: "listen from the file", got: c.Listen, want: "0.0.0.0:7000"},
+		{setting: "dataDir from the file", got: c.DataDir, want: "/var/mud"},
+		{setting: "maxConnections from the env", got: c.MaxConnections, want: 20},
+		{setting: "tick from the flag", got: c.TickRate.Duration, want: 100 * time.Millisecond},
+		{setting: "idleTimeout from the defaults", got: c.IdleTimeout.Duration, want: 30 * time.Minute},
+	}
+	for i, tc := range testCases {
+		if tc.got != tc.want {
+			t.Fatalf("Testcase %d: %s: Got %v, expected %v", i, tc.setting, tc.got, tc.want)
+		}
+	}
+}
+
+func TestAllowedOriginsAreSplit(t *testing.T) {
+	c, err := Load([]string{"-web-origins", "https://example.com, http://localhost:8080,"}, envOf(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com", "http://localhost:8080"}
+	if got := c.AllowedOrigins(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got %q, expected %q", got, want)
+	}
+}
+
+func TestInvalidConfigIsRejected(t *testing.T) {
+	testCases := []struct {
+		args []string
+		env  map[string]string
+	}{
+		{args: []string{"-listen", "localhost"}},
+		{args: []string{"-tick", "0s"}},
+		{args: []string{"-max-connections", "-1"}},
+		{args: []string{"-slow-client-policy", "ignore"}},
+		{args: []string{"-output-queue", "0"}},
+		{args: []string{"-pprof", "-pprof-listen", "8000"}},
+		{args: []string{"-web", "-web-listen", "localhost"}},
+		{args: []string{"-ssh", "-ssh-listen", "6022"}},
+		{args: []string{"-tls"}},
+		{args: []string{"-tls", "-tls-cert", "cert.pem"}},
+		{env: map[string]string{"MUD_IDLE_TIMEOUT": "soon"}},
+		{args: []string{"-config", writeConfigFile(t, `{"tick": "1s"}`)}},
+		{args: []string{"-config", writeConfigFile(t, `{"tickRate": 1}`)}},
+	}
+
+	for i, tc := range testCases {
+		if _, err := Load(tc.args, envOf(tc.env)); err == nil {
+			t.Fatalf("Testcase %d: expected an error", i)
+		}
+	}
+}
+
+func TestValidationNamesTheSetting(t *testing.T) {
+	_, err := Load([]string{"-tick", "-1s"}, envOf(nil))
+
+	var invalid ErrInvalidConfig
+	if !errors.As(err, &invalid) || invalid.setting != "tickRate" {
+		t.Fatalf("Got %v, expected tickRate to be invalid", err)
+	}
+}
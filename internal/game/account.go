@@ -1,24 +1,82 @@
 package game
 
+// Connection is the client's end of the connection as seen by the game
+type Connection interface {
+	// SuppressEcho stops the client from echoing what the user types,
+	// e.g. while typing a password
+	SuppressEcho(suppress bool)
+	WindowSize() (width, height int)
+	TerminalType() string
+	// Kick disconnects the client once the next reply has been sent
+	Kick()
+	// AuthenticatedAccount is the name of the account the client has already
+	// been authenticated as, e.g. over SSH. Empty for the others.
+	AuthenticatedAccount() string
+	// SendEvent sends the structured data if the client supports it
+	SendEvent(event Event)
+	// InputDone tells that the client's input, or its disconnect, has been
+	// processed and everything it replied has been sent
+	InputDone()
+}
+
 type Account struct {
-	id                ClientId
-	directReply       func(mesage string)
-	reply             func(message string)
-	broadcast         func(message string)
+	id         ClientId
+	connection Connection
+	// output sends the message to the client
+	output            func(message string)
 	loggedInCharacter *Character
+
+	loginState     loginState
+	data           AccountData
+	failedAttempts int
+
+	// the events last sent to the client
+	sentVitals CharVitals
+	sentStatus CharStatus
+	sentRoom   RoomId
 }
 
 func NewAccount(
 	clientId ClientId,
-	directReply func(mesage string),
-	reply func(message string),
-	broadcast func(message string),
+	connection Connection,
+	output func(message string),
 ) *Account {
 	return &Account{
 		id:                clientId,
-		directReply:       directReply,
-		reply:             reply,
-		broadcast:         broadcast,
+		connection:        connection,
+		output:            output,
 		loggedInCharacter: nil,
+		loginState:        loginAccountName,
+	}
+}
+
+func (a *Account) suppressEcho(suppress bool) {
+	if a.connection != nil {
+		a.connection.SuppressEcho(suppress)
+	}
+}
+
+func (a *Account) authenticatedAccount() string {
+	if a.connection != nil {
+		return a.connection.AuthenticatedAccount()
+	}
+	return ""
+}
+
+func (a *Account) inputDone() {
+	if a.connection != nil {
+		a.connection.InputDone()
+	}
+}
+
+func (a *Account) kick() {
+	if a.connection != nil {
+		a.connection.Kick()
+	}
+}
+
+func (a *Account) sendEvent(event Event) {
+	if a.connection != nil {
+		a.connection.SendEvent(event)
 	}
 }
@@ -0,0 +1,111 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrAccountNotFound = errors.New("account not found")
+
+// AccountData is the part of the account that is stored between sessions
+type AccountData struct {
+	Name         string   `json:"name"`
+	PasswordHash []byte   `json:"passwordHash"`
+	Characters   []string `json:"characters"`
+	// Admin gives the characters of the account the admin commands
+	Admin bool `json:"admin,omitempty"`
+	// PublicKeys are the SSH keys the account can log in with in the
+	// authorized_keys format
+	PublicKeys []string `json:"publicKeys,omitempty"`
+}
+
+type AccountStore interface {
+	// LoadAccount returns ErrAccountNotFound if there's no account by the name
+	LoadAccount(name string) (AccountData, error)
+	SaveAccount(data AccountData) error
+}
+
+type MemoryAccountStore struct {
+	accounts map[string]AccountData
+}
+
+func NewMemoryAccountStore() *MemoryAccountStore {
+	return &MemoryAccountStore{accounts: make(map[string]AccountData)}
+}
+
+func (s *MemoryAccountStore) LoadAccount(name string) (AccountData, error) {
+	data, ok := s.accounts[strings.ToLower(name)]
+	if !ok {
+		return AccountData{}, ErrAccountNotFound
+	}
+	return data, nil
+}
+
+func (s *MemoryAccountStore) SaveAccount(data AccountData) error {
+	s.accounts[strings.ToLower(data.Name)] = data
+	return nil
+}
+
+// FileAccountStore stores every account as a JSON file in the directory
+type FileAccountStore struct {
+	dir string
+}
+
+func NewFileAccountStore(dir string) (*FileAccountStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileAccountStore{dir: dir}, nil
+}
+
+func (s *FileAccountStore) path(name string) (string, error) {
+	if !IsValidName(name) {
+		return "", ErrInvalidName{name: name}
+	}
+	return filepath.Join(s.dir, strings.ToLower(name)+".json"), nil
+}
+
+func (s *FileAccountStore) LoadAccount(name string) (AccountData, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return AccountData{}, err
+	}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return AccountData{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return AccountData{}, err
+	}
+
+	var data AccountData
+	err = json.Unmarshal(contents, &data)
+	return data, err
+}
+
+func (s *FileAccountStore) SaveAccount(data AccountData) error {
+	path, err := s.path(data.Name)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, contents)
+}
+
+// writeFileAtomically writes to a temporary file first so a crash never
+// leaves a half written file behind
+func writeFileAtomically(path string, contents []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, contents, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,35 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFileAccountStore(t *testing.T) {
+	store, err := NewFileAccountStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.LoadAccount("abel"); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("Got %v, expected ErrAccountNotFound", err)
+	}
+
+	data := AccountData{Name: "Abel", PasswordHash: []byte("hash"), Characters: []string{"Bella"}}
+	if err := store.SaveAccount(data); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.LoadAccount("abel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "Abel" || string(loaded.PasswordHash) != "hash" || len(loaded.Characters) != 1 {
+		t.Fatalf("Got %+v, expected %+v", loaded, data)
+	}
+
+	var invalid ErrInvalidName
+	if _, err := store.LoadAccount("../abel"); !errors.As(err, &invalid) {
+		t.Fatalf("Got %v, expected ErrInvalidName", err)
+	}
+}
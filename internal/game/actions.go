@@ -24,12 +24,29 @@ func (e ErrUnknownCharacter) Error() string {
 	return fmt.Sprintf("unknown character. Client id for %s. Action: %s", e.id, e.action)
 }
 
+type CommandMode int
+
+const (
+	// Instant commands are run as soon as they arrive
+	Instant CommandMode = iota
+	// Timed commands make the character wait for the lag before the next
+	// timed command. The commands given while waiting are run on the tick
+	// the wait is over.
+	Timed
+)
+
+// movementLag is how many ticks the character waits after moving
+const movementLag = 1
+
 type CommandInfo struct {
 	command     string
 	aliases     []string
 	description string
 	parser      func(command, rest string) Command
 	action      CommandAction
+	mode        CommandMode
+	// lag is the wait in ticks after a timed command
+	lag int
 }
 
 var inGameCommandInfos = []CommandInfo{
@@ -53,23 +70,17 @@ var inGameCommandInfos = []CommandInfo{
 	},
 	{
 		command:     "go",
-		aliases:     []string{"n", "e", "s", "w"},
-		description: "Move to east, west, north or south",
-		parser: func(command, rest string) Command {
-			message := rest
-			switch command {
-			case "n":
-				message = "north"
-			case "e":
-				message = "east"
-			case "s":
-				message = "south"
-			case "w":
-				message = "west"
+		aliases:     directionAliases(),
+		description: "Move to a direction or through an exit, e.g. go north or n",
+		parser: func(command, rest string) Command {
+			if dir := DirectionFromString(command); dir != None {
+				return Command{"go", string(dir)}
 			}
-			return Command{"go", message}
+			return Command{"go", rest}
 		},
 		action: GoCommandAction,
+		mode:   Timed,
+		lag:    movementLag,
 	},
 	{
 		command:     "look",
@@ -89,10 +100,229 @@ var inGameCommandInfos = []CommandInfo{
 		},
 		action: SmokeCommandAction,
 	},
+	{
+		command:     "open",
+		aliases:     []string{},
+		description: "Open a door, e.g. open east or open door",
+		parser: func(command, rest string) Command {
+			return Command{"open", rest}
+		},
+		action: OpenCommandAction,
+	},
+	{
+		command:     "close",
+		aliases:     []string{},
+		description: "Close a door",
+		parser: func(command, rest string) Command {
+			return Command{"close", rest}
+		},
+		action: CloseCommandAction,
+	},
+	{
+		command:     "lock",
+		aliases:     []string{},
+		description: "Lock a door with its key",
+		parser: func(command, rest string) Command {
+			return Command{"lock", rest}
+		},
+		action: LockCommandAction,
+	},
+	{
+		command:     "unlock",
+		aliases:     []string{},
+		description: "Unlock a door with its key",
+		parser: func(command, rest string) Command {
+			return Command{"unlock", rest}
+		},
+		action: UnlockCommandAction,
+	},
+	{
+		command:     "pick",
+		aliases:     []string{},
+		description: "Pick the lock of a door without the key",
+		parser: func(command, rest string) Command {
+			return Command{"pick", rest}
+		},
+		action: PickCommandAction,
+	},
+	{
+		command:     "get",
+		aliases:     []string{"take"},
+		description: "Pick up an item, e.g. get key or get all from corpse",
+		parser: func(command, rest string) Command {
+			return Command{"get", rest}
+		},
+		action: GetCommandAction,
+	},
+	{
+		command:     "drop",
+		aliases:     []string{},
+		description: "Drop an item to the room",
+		parser: func(command, rest string) Command {
+			return Command{"drop", rest}
+		},
+		action: DropCommandAction,
+	},
+	{
+		command:     "give",
+		aliases:     []string{},
+		description: "Give an item to someone, e.g. give key to bella",
+		parser: func(command, rest string) Command {
+			return Command{"give", rest}
+		},
+		action: GiveCommandAction,
+	},
+	{
+		command:     "inventory",
+		aliases:     []string{"i", "inv"},
+		description: "List the items you are carrying",
+		parser: func(command, rest string) Command {
+			return Command{"inventory", ""}
+		},
+		action: InventoryCommandAction,
+	},
+	{
+		command:     "examine",
+		aliases:     []string{"exa"},
+		description: "Take a closer look at an item",
+		parser: func(command, rest string) Command {
+			return Command{"examine", rest}
+		},
+		action: ExamineCommandAction,
+	},
+	{
+		command:     "wear",
+		aliases:     []string{},
+		description: "Wear a piece of armor or clothing",
+		parser: func(command, rest string) Command {
+			return Command{"wear", rest}
+		},
+		action: WearCommandAction,
+	},
+	{
+		command:     "wield",
+		aliases:     []string{},
+		description: "Wield a weapon",
+		parser: func(command, rest string) Command {
+			return Command{"wield", rest}
+		},
+		action: WieldCommandAction,
+	},
+	{
+		command:     "remove",
+		aliases:     []string{},
+		description: "Stop using a worn or wielded item",
+		parser: func(command, rest string) Command {
+			return Command{"remove", rest}
+		},
+		action: RemoveCommandAction,
+	},
+	{
+		command:     "equipment",
+		aliases:     []string{"eq"},
+		description: "List the items you are using",
+		parser: func(command, rest string) Command {
+			return Command{"equipment", ""}
+		},
+		action: EquipmentCommandAction,
+	},
+	{
+		command:     "score",
+		aliases:     []string{"sc"},
+		description: "Show your health and stats",
+		parser: func(command, rest string) Command {
+			return Command{"score", ""}
+		},
+		action: ScoreCommandAction,
+	},
+	{
+		command:     "kill",
+		aliases:     []string{"attack", "k"},
+		description: "Attack someone, e.g. kill bella",
+		parser: func(command, rest string) Command {
+			return Command{"kill", rest}
+		},
+		action: KillCommandAction,
+		mode:   Timed,
+		lag:    1,
+	},
+	{
+		command:     "flee",
+		aliases:     []string{},
+		description: "Try to run away from a fight",
+		parser: func(command, rest string) Command {
+			return Command{"flee", ""}
+		},
+		action: FleeCommandAction,
+		mode:   Timed,
+		lag:    2,
+	},
+}
+
+var adminCommandInfos = []CommandInfo{
+	{
+		command:     "reset",
+		aliases:     []string{},
+		description: "Reset an area, or the current one without a name",
+		parser: func(command, rest string) Command {
+			return Command{"reset", rest}
+		},
+		action: ResetCommandAction,
+	},
+}
+
+// DisconnectAction saves the logged in character and removes it and the
+// account from the world. The account is replied to when done so the client
+// knows that nothing is going to be sent to it anymore.
+func DisconnectAction(account *Account) WorldAction {
+	return func(world *World) error {
+		if ch := account.loggedInCharacter; ch != nil {
+			world.stopFighting(ch)
+			world.SaveCharacter(ch)
+			world.RemoveCharacterOnDisconnect(ch)
+			world.BroadcastToOtherCharactersInRoom(
+				ch,
+				fmt.Sprintf("%v disconnected\n", ch.Name),
+			)
+			account.loggedInCharacter = nil
+		}
+		world.RemoveAccount(account.id)
+
+		account.output("Goodbye!\n")
+
+		return nil
+	}
+}
+
+func AnnounceAction(message string) WorldAction {
+	return func(world *World) error {
+		for _, account := range world.accounts {
+			account.output(message)
+		}
+
+		return nil
+	}
+}
+
+// directionAliases lets the directions be typed as commands
+func directionAliases() []string {
+	var aliases []string
+	for abbreviation := range directionAbbreviations {
+		aliases = append(aliases, abbreviation)
+	}
+	for _, dir := range directions {
+		aliases = append(aliases, string(dir))
+	}
+	return aliases
 }
 
 func UnknownCommandAction(command Command, ch *Character) WorldAction {
 	return func(w *World) error {
+		// custom exits like "portal" are typed as commands
+		if w.rooms[ch.Room].HasExit(command.contents) {
+			return timedAction(ch, GoCommandAction(Command{"go", command.contents}, ch), movementLag)(w)
+		}
+
 		ch.Reply(fmt.Sprintf("What is %s?\n", command.contents))
 
 		return nil
@@ -107,6 +337,7 @@ func SayCommandAction(command Command, ch *Character) WorldAction {
 			ch,
 			fmt.Sprintf("%s said %s\n", ch.Name, command.contents),
 		)
+		world.respondToSay(ch, command.contents)
 
 		return nil
 	}
@@ -114,7 +345,7 @@ func SayCommandAction(command Command, ch *Character) WorldAction {
 
 func LookCommandAction(command Command, ch *Character) WorldAction {
 	return func(world *World) error {
-		ch.Reply(fmt.Sprintf("You look around\n%s\n", world.DescribeRoom(ch.Coordinate)))
+		ch.Reply(fmt.Sprintf("You look around\n%s\n", world.DescribeRoom(ch.Room)))
 
 		return nil
 	}
@@ -122,27 +353,32 @@ func LookCommandAction(command Command, ch *Character) WorldAction {
 
 func GoCommandAction(command Command, ch *Character) WorldAction {
 	return func(world *World) error {
-		direction := DirectionFromString(command.contents)
+		direction := exitKeyword(command.contents)
+		exit := world.rooms[ch.Room].Exit(direction)
 		if command.contents == "" {
 			ch.Reply("In which direction do you want to move?\n")
+		} else if ch.opponent != nil {
+			ch.Reply("You are fighting! Try to flee\n")
+		} else if exit != nil && !exit.IsPassable() && !exit.hidden {
+			ch.Reply(fmt.Sprintf("The door %s is closed\n", direction))
 		} else if world.CanCharactorMoveInDirection(ch, direction) {
 			// broadcast to old room
 			world.BroadcastToOtherCharactersInRoom(
 				ch,
-				fmt.Sprintf("%s moved to %s\n", ch.Name, command.contents),
+				fmt.Sprintf("%s moved to %s\n", ch.Name, direction),
 			)
 
 			world.MoveCharacterInDirection(ch, direction)
 			ch.Reply(
 				fmt.Sprintf("You move to %s\n%s\n",
-					command.contents,
-					world.DescribeRoom(ch.Coordinate)),
+					direction,
+					world.DescribeRoom(ch.Room)),
 			)
 
 			// broadcast to new room
 			world.BroadcastToOtherCharactersInRoom(
 				ch,
-				fmt.Sprintf("%s entered from %s\n", ch.Name, command.contents),
+				fmt.Sprintf("%s entered from %s\n", ch.Name, direction),
 			)
 		} else {
 			ch.Reply("You cannot go that way!\n")
@@ -154,9 +390,15 @@ func GoCommandAction(command Command, ch *Character) WorldAction {
 
 func SmokeCommandAction(command Command, ch *Character) WorldAction {
 	return func(world *World) error {
+		if ch.opponent != nil {
+			ch.Reply("Not while fighting!\n")
+			return nil
+		}
+
 		switch command.contents {
 		case "start":
 			ch.SetState("smoking")
+			world.characterChanged(ch)
 			ch.Reply("You started to smoke your pipe\n")
 
 			world.BroadcastToOtherCharactersInRoom(
@@ -165,6 +407,7 @@ func SmokeCommandAction(command Command, ch *Character) WorldAction {
 			)
 		case "stop":
 			ch.SetState("idle")
+			world.characterChanged(ch)
 			ch.Reply("You stopped smoking your pipe\n")
 
 			world.BroadcastToOtherCharactersInRoom(
@@ -0,0 +1,603 @@
+package game
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed areas/*.json
+var embeddedAreas embed.FS
+
+type Area struct {
+	Name  string
+	Rooms []*Room
+	Items []*ItemTemplate
+	Mobs  []*MobTemplate
+	// Resets are run in order when the area is reset. The items and the
+	// mobs listed in the rooms come first.
+	Resets []ResetRule
+	// ResetInterval is how often the area is reset, zero if never
+	ResetInterval time.Duration
+	// ResetOnlyWhenEmpty delays the reset until there are no players in
+	// the area
+	ResetOnlyWhenEmpty bool
+}
+
+type areaFile struct {
+	Name   string     `json:"name"`
+	Rooms  []roomFile `json:"rooms"`
+	Items  []itemFile `json:"items"`
+	Mobs   []mobFile  `json:"mobs"`
+	Resets resetsFile `json:"resets"`
+}
+
+type resetsFile struct {
+	// Interval is a duration like "10m"
+	Interval      string      `json:"interval"`
+	OnlyWhenEmpty bool        `json:"onlyWhenEmpty"`
+	Rules         []resetFile `json:"rules"`
+}
+
+// resetFile has exactly one of spawn, put, give and door set
+type resetFile struct {
+	Spawn MobTemplateId  `json:"spawn"`
+	Put   ItemTemplateId `json:"put"`
+	Give  ItemTemplateId `json:"give"`
+	Door  string         `json:"door"`
+	Room  RoomId         `json:"room"`
+	Mob   MobTemplateId  `json:"mob"`
+	// Max is how many there can be at most, one by default
+	Max   int       `json:"max"`
+	State DoorState `json:"state"`
+}
+
+type mobFile struct {
+	Id         MobTemplateId     `json:"id"`
+	Name       string            `json:"name"`
+	Keywords   []string          `json:"keywords"`
+	Long       string            `json:"long"`
+	Stats      Stats             `json:"stats"`
+	Behaviours []MobBehaviour    `json:"behaviours"`
+	Responses  map[string]string `json:"responses"`
+	Items      []ItemTemplateId  `json:"items"`
+}
+
+type itemFile struct {
+	Id       ItemTemplateId `json:"id"`
+	Keywords []string       `json:"keywords"`
+	Short    string         `json:"short"`
+	Long     string         `json:"long"`
+	Weight   int            `json:"weight"`
+	Flags    []ItemFlag     `json:"flags"`
+	Slot     EquipSlot      `json:"slot"`
+	Stats    Stats          `json:"stats"`
+}
+
+type roomFile struct {
+	Id          RoomId              `json:"id"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Coordinate  *Coordinate         `json:"coordinate"`
+	Exits       map[string]exitFile `json:"exits"`
+	Flags       []RoomFlag          `json:"flags"`
+	Items       []ItemTemplateId    `json:"items"`
+	Mobs        []MobTemplateId     `json:"mobs"`
+}
+
+// exitFile is either just the id of the room the exit leads to or an
+// object with the door and the rest
+type exitFile struct {
+	To     RoomId    `json:"to"`
+	Door   *doorFile `json:"door"`
+	Hidden bool      `json:"hidden"`
+}
+
+type doorFile struct {
+	State    DoorState `json:"state"`
+	Key      string    `json:"key"`
+	Pickable bool      `json:"pickable"`
+}
+
+func (e *exitFile) UnmarshalJSON(data []byte) error {
+	var to RoomId
+	if err := json.Unmarshal(data, &to); err == nil {
+		*e = exitFile{To: to}
+		return nil
+	}
+
+	type plain exitFile
+	return decodeStrictly(data, (*plain)(e))
+}
+
+// decodeStrictly refuses the fields which aren't known so that a typo in an
+// area file isn't silently ignored
+func decodeStrictly(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// ErrInvalidAreas lists everything that is wrong with the loaded areas
+type ErrInvalidAreas struct {
+	problems []string
+}
+
+func (e ErrInvalidAreas) Error() string {
+	return fmt.Sprintf("invalid areas:\n\t%s", strings.Join(e.problems, "\n\t"))
+}
+
+// DefaultAreas are the areas embedded in the binary
+func DefaultAreas() []Area {
+	dir, err := fs.Sub(embeddedAreas, "areas")
+	if err != nil {
+		panic(err)
+	}
+	areas, err := LoadAreas(dir)
+	if err != nil {
+		panic(err)
+	}
+	return areas
+}
+
+// LoadAreas loads and validates every .json area file in the directory
+func LoadAreas(dir fs.FS) ([]Area, error) {
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []areaFile
+	var fileNames []string
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		contents, err := fs.ReadFile(dir, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		var file areaFile
+		if err := decodeStrictly(contents, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		files = append(files, file)
+		fileNames = append(fileNames, entry.Name())
+	}
+
+	if len(files) == 0 {
+		return nil, ErrInvalidAreas{problems: []string{"no area files found"}}
+	}
+
+	return parseAreas(files, fileNames)
+}
+
+func parseAreas(files []areaFile, fileNames []string) ([]Area, error) {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	itemFiles := make(map[ItemTemplateId]string)
+	mobFiles := make(map[MobTemplateId]string)
+	roomFiles := make(map[RoomId]roomFile)
+	roomFileNames := make(map[RoomId]string)
+	for i, file := range files {
+		if file.Name == "" {
+			problem("%s: area has no name", fileNames[i])
+		}
+		for _, item := range file.Items {
+			where := fmt.Sprintf("%s: item %q", fileNames[i], item.Id)
+			if item.Id == "" {
+				problem("%s: item %q has no id", fileNames[i], item.Short)
+				continue
+			}
+			if other, ok := itemFiles[item.Id]; ok {
+				problem("%s is already defined in %s", where, other)
+				continue
+			}
+			itemFiles[item.Id] = fileNames[i]
+			if len(item.Keywords) == 0 {
+				problem("%s has no keywords", where)
+			}
+			if item.Weight < 0 {
+				problem("%s has a negative weight", where)
+			}
+			for _, flag := range item.Flags {
+				if !knownItemFlags[flag] {
+					problem("%s has an unknown flag %q", where, flag)
+				}
+			}
+			if item.Slot != "" && !isEquipSlot(item.Slot) {
+				problem("%s has an unknown slot %q", where, item.Slot)
+			}
+		}
+		for _, mob := range file.Mobs {
+			where := fmt.Sprintf("%s: mob %q", fileNames[i], mob.Id)
+			if mob.Id == "" {
+				problem("%s: mob %q has no id", fileNames[i], mob.Name)
+				continue
+			}
+			if other, ok := mobFiles[mob.Id]; ok {
+				problem("%s is already defined in %s", where, other)
+				continue
+			}
+			mobFiles[mob.Id] = fileNames[i]
+			if mob.Name == "" {
+				problem("%s has no name", where)
+			}
+			if len(mob.Keywords) == 0 {
+				problem("%s has no keywords", where)
+			}
+			if mob.Stats.MaxHealth <= 0 {
+				problem("%s has no health", where)
+			}
+			for _, behaviour := range mob.Behaviours {
+				if !knownMobBehaviours[behaviour] {
+					problem("%s has an unknown behaviour %q", where, behaviour)
+				}
+			}
+		}
+		for _, room := range file.Rooms {
+			if room.Id == "" {
+				problem("%s: room %q has no id", fileNames[i], room.Title)
+				continue
+			}
+			if other, ok := roomFileNames[room.Id]; ok {
+				problem("%s: room %q is already defined in %s", fileNames[i], room.Id, other)
+				continue
+			}
+			roomFiles[room.Id] = room
+			roomFileNames[room.Id] = fileNames[i]
+		}
+	}
+
+	locations := make(map[Coordinate]RoomId)
+	var startRooms, respawnRooms []RoomId
+	for _, id := range sortedRoomIds(roomFiles) {
+		room := roomFiles[id]
+		where := fmt.Sprintf("%s: room %q", roomFileNames[id], id)
+
+		if room.Coordinate != nil {
+			if other, ok := locations[*room.Coordinate]; ok {
+				problem("%s has the same coordinate %s as room %q", where, *room.Coordinate, other)
+			} else {
+				locations[*room.Coordinate] = id
+			}
+		}
+
+		for _, flag := range room.Flags {
+			if !knownRoomFlags[flag] {
+				problem("%s has an unknown flag %q", where, flag)
+			}
+			if flag == StartRoom {
+				startRooms = append(startRooms, id)
+			}
+			if flag == RespawnRoom {
+				respawnRooms = append(respawnRooms, id)
+			}
+		}
+
+		for _, item := range room.Items {
+			if _, ok := itemFiles[item]; !ok {
+				problem("%s has an unknown item %q", where, item)
+			}
+		}
+		for _, mob := range room.Mobs {
+			if _, ok := mobFiles[mob]; !ok {
+				problem("%s has an unknown mob %q", where, mob)
+			}
+		}
+
+		keywords := make(map[string]bool)
+		for _, name := range sortedExitNames(room.Exits) {
+			keyword := exitKeyword(name)
+			exit := room.Exits[name]
+			if _, ok := roomFiles[exit.To]; !ok {
+				problem("%s has an exit %s to an unknown room %q", where, name, exit.To)
+			}
+			if exit.Door != nil && !knownDoorStates[exit.Door.State] {
+				problem("%s has a door %s with an unknown state %q", where, name, exit.Door.State)
+			}
+			if exit.Door != nil && exit.Door.State == DoorLocked && exit.Door.Key == "" {
+				problem("%s has a locked door %s without a key", where, name)
+			}
+			if exit.Door != nil && exit.Door.Key != "" {
+				if _, ok := itemFiles[ItemTemplateId(exit.Door.Key)]; !ok {
+					problem("%s has a door %s with a key %q which is not an item", where, name, exit.Door.Key)
+				}
+			}
+			if keywords[keyword] {
+				problem("%s has the exit %s more than once", where, keyword)
+			}
+			keywords[keyword] = true
+			if DirectionFromString(keyword) == None && isCommand(keyword) {
+				problem("%s has an exit %q which is also a command", where, keyword)
+			}
+		}
+	}
+
+	for i, file := range files {
+		for _, mob := range file.Mobs {
+			for _, item := range mob.Items {
+				if _, ok := itemFiles[item]; !ok {
+					problem("%s: mob %q has an unknown item %q", fileNames[i], mob.Id, item)
+				}
+			}
+		}
+	}
+
+	for i, file := range files {
+		if file.Resets.Interval != "" {
+			if _, err := time.ParseDuration(file.Resets.Interval); err != nil {
+				problem("%s: invalid reset interval %q", fileNames[i], file.Resets.Interval)
+			}
+		}
+		for j, rule := range file.Resets.Rules {
+			where := fmt.Sprintf("%s: reset %d", fileNames[i], j+1)
+			kinds := 0
+			for _, set := range []bool{rule.Spawn != "", rule.Put != "", rule.Give != "", rule.Door != ""} {
+				if set {
+					kinds++
+				}
+			}
+			if kinds != 1 {
+				problem("%s should have exactly one of spawn, put, give and door", where)
+				continue
+			}
+			if rule.Max < 0 {
+				problem("%s has a negative max", where)
+			}
+
+			if rule.Give != "" {
+				if _, ok := mobFiles[rule.Mob]; !ok {
+					problem("%s gives to an unknown mob %q", where, rule.Mob)
+				}
+			} else if roomFileNames[rule.Room] != fileNames[i] {
+				problem("%s has a room %q which is not in the area", where, rule.Room)
+				continue
+			}
+			switch {
+			case rule.Spawn != "":
+				if _, ok := mobFiles[rule.Spawn]; !ok {
+					problem("%s spawns an unknown mob %q", where, rule.Spawn)
+				}
+			case rule.Put != "" || rule.Give != "":
+				item := rule.Put
+				if item == "" {
+					item = rule.Give
+				}
+				if _, ok := itemFiles[item]; !ok {
+					problem("%s has an unknown item %q", where, item)
+				}
+			case rule.Door != "":
+				exit, ok := roomFiles[rule.Room].Exits[rule.Door]
+				if !ok {
+					exit, ok = roomFiles[rule.Room].Exits[exitKeyword(rule.Door)]
+				}
+				if !ok || exit.Door == nil {
+					problem("%s has no door %s in room %q", where, rule.Door, rule.Room)
+				}
+				if !knownDoorStates[rule.State] {
+					problem("%s has an unknown door state %q", where, rule.State)
+				}
+			}
+		}
+	}
+
+	if len(respawnRooms) > 1 {
+		problem("there should be at most one room flagged %q, found %d", RespawnRoom, len(respawnRooms))
+	}
+	if len(startRooms) != 1 {
+		problem("there should be exactly one room flagged %q, found %d", StartRoom, len(startRooms))
+	} else {
+		for _, id := range unreachableRooms(roomFiles, startRooms[0]) {
+			problem("%s: room %q can't be reached from the start room", roomFileNames[id], id)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, ErrInvalidAreas{problems: problems}
+	}
+
+	areas := make([]Area, len(files))
+	for i, file := range files {
+		areas[i].Name = file.Name
+		for _, item := range file.Items {
+			areas[i].Items = append(areas[i].Items, newItemTemplateFromFile(item))
+		}
+		for _, mob := range file.Mobs {
+			areas[i].Mobs = append(areas[i].Mobs, newMobTemplateFromFile(mob))
+		}
+		for _, room := range file.Rooms {
+			areas[i].Rooms = append(areas[i].Rooms, newRoomFromFile(file.Name, room))
+		}
+		areas[i].Resets = newResetRulesFromFile(file)
+		areas[i].ResetInterval, _ = time.ParseDuration(file.Resets.Interval)
+		areas[i].ResetOnlyWhenEmpty = file.Resets.OnlyWhenEmpty
+	}
+	return areas, nil
+}
+
+func newRoomFromFile(area string, file roomFile) *Room {
+	room := &Room{
+		id:          file.Id,
+		area:        area,
+		title:       file.Title,
+		description: file.Description,
+		location:    file.Coordinate,
+		flags:       file.Flags,
+	}
+	for name, exitFile := range file.Exits {
+		exit := &Exit{keyword: exitKeyword(name), to: exitFile.To, hidden: exitFile.Hidden}
+		if door := exitFile.Door; door != nil {
+			exit.door = &Door{
+				state:        door.State,
+				defaultState: door.State,
+				key:          door.Key,
+				pickable:     door.Pickable,
+			}
+		}
+		room.exits = append(room.exits, exit)
+	}
+	sortExits(room.exits)
+	return room
+}
+
+func newItemTemplateFromFile(file itemFile) *ItemTemplate {
+	keywords := make([]string, len(file.Keywords))
+	for i, keyword := range file.Keywords {
+		keywords[i] = strings.ToLower(keyword)
+	}
+	return &ItemTemplate{
+		id:       file.Id,
+		keywords: keywords,
+		short:    file.Short,
+		long:     file.Long,
+		weight:   file.Weight,
+		flags:    file.Flags,
+		slot:     file.Slot,
+		stats:    file.Stats,
+	}
+}
+
+func newMobTemplateFromFile(file mobFile) *MobTemplate {
+	keywords := make([]string, len(file.Keywords))
+	for i, keyword := range file.Keywords {
+		keywords[i] = strings.ToLower(keyword)
+	}
+	responses := make(map[string]string)
+	for keyword, response := range file.Responses {
+		responses[strings.ToLower(keyword)] = response
+	}
+	return &MobTemplate{
+		id:         file.Id,
+		name:       file.Name,
+		keywords:   keywords,
+		long:       file.Long,
+		stats:      file.Stats,
+		behaviours: file.Behaviours,
+		responses:  responses,
+		items:      file.Items,
+	}
+}
+
+// newResetRulesFromFile turns the items and the mobs listed in the rooms to
+// the reset rules and appends the rules of the file after them
+func newResetRulesFromFile(file areaFile) []ResetRule {
+	var rules []ResetRule
+	for _, room := range file.Rooms {
+		counts := make(map[ItemTemplateId]int)
+		var items []ItemTemplateId
+		for _, item := range room.Items {
+			if counts[item] == 0 {
+				items = append(items, item)
+			}
+			counts[item]++
+		}
+		for _, item := range items {
+			rules = append(rules, ResetRule{kind: resetPut, room: room.Id, item: item, max: counts[item]})
+		}
+
+		mobCounts := make(map[MobTemplateId]int)
+		var mobs []MobTemplateId
+		for _, mob := range room.Mobs {
+			if mobCounts[mob] == 0 {
+				mobs = append(mobs, mob)
+			}
+			mobCounts[mob]++
+		}
+		for _, mob := range mobs {
+			rules = append(rules, ResetRule{kind: resetSpawn, room: room.Id, mob: mob, max: mobCounts[mob]})
+		}
+	}
+
+	for _, rule := range file.Resets.Rules {
+		max := rule.Max
+		if max == 0 {
+			max = 1
+		}
+		switch {
+		case rule.Spawn != "":
+			rules = append(rules, ResetRule{kind: resetSpawn, room: rule.Room, mob: rule.Spawn, max: max})
+		case rule.Put != "":
+			rules = append(rules, ResetRule{kind: resetPut, room: rule.Room, item: rule.Put, max: max})
+		case rule.Give != "":
+			rules = append(rules, ResetRule{kind: resetGive, mob: rule.Mob, item: rule.Give})
+		case rule.Door != "":
+			rules = append(rules, ResetRule{kind: resetDoor, room: rule.Room, door: exitKeyword(rule.Door), state: rule.State})
+		}
+	}
+	return rules
+}
+
+// exitKeyword turns the abbreviated directions to the full ones
+func exitKeyword(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if dir := DirectionFromString(name); dir != None {
+		return string(dir)
+	}
+	return name
+}
+
+func isCommand(word string) bool {
+	for _, info := range append(append([]CommandInfo{}, inGameCommandInfos...), adminCommandInfos...) {
+		if info.command == word {
+			return true
+		}
+		for _, alias := range info.aliases {
+			if alias == word {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedRoomIds(rooms map[RoomId]roomFile) []RoomId {
+	ids := make([]RoomId, 0, len(rooms))
+	for id := range rooms {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func sortedExitNames(exits map[string]exitFile) []string {
+	names := make([]string, 0, len(exits))
+	for name := range exits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func unreachableRooms(rooms map[RoomId]roomFile, start RoomId) []RoomId {
+	reached := map[RoomId]bool{start: true}
+	queue := []RoomId{start}
+	for len(queue) > 0 {
+		room := rooms[queue[0]]
+		queue = queue[1:]
+		for _, exit := range room.Exits {
+			if _, ok := rooms[exit.To]; ok && !reached[exit.To] {
+				reached[exit.To] = true
+				queue = append(queue, exit.To)
+			}
+		}
+	}
+
+	var unreachable []RoomId
+	for _, id := range sortedRoomIds(rooms) {
+		if !reached[id] {
+			unreachable = append(unreachable, id)
+		}
+	}
+	return unreachable
+}
@@ -0,0 +1,234 @@
+package game
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDefaultAreas(t *testing.T) {
+	areas := DefaultAreas()
+	if len(areas) != 1 || len(areas[0].Rooms) != 2 {
+		t.Fatalf("Got %+v, expected the basic area", areas)
+	}
+
+	w := NewWorld()
+	if w.startRoom != "room" {
+		t.Fatalf("Got start room %s", w.startRoom)
+	}
+	if exit := w.rooms["another-room"].Exit("west"); exit == nil || exit.to != "room" {
+		t.Fatal("another room should have an exit to west")
+	}
+}
+
+func TestLoadAreas(t *testing.T) {
+	dir := fstest.MapFS{
+		"town.json": {Data: []byte(`{
+			"name": "town",
+			"rooms": [
+				{"id": "square", "title": "Square", "coordinate": {"x": 0, "y": 0},
+				 "exits": {"north": "gate"}, "flags": ["start"]}
+			]
+		}`)},
+		"forest.json": {Data: []byte(`{
+			"name": "forest",
+			"rooms": [
+				{"id": "gate", "title": "Gate", "coordinate": {"x": 0, "y": -1},
+				 "exits": {"south": "square"}}
+			]
+		}`)},
+		"readme.txt": {Data: []byte("not an area")},
+	}
+
+	areas, err := LoadAreas(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(areas) != 2 {
+		t.Fatalf("Got %d areas, expected 2", len(areas))
+	}
+
+	w := NewWorld(WithAreas(areas))
+	gate := w.rooms["gate"]
+	if gate.area != "forest" || *gate.location != NewCoordinate(0, -1) || !gate.HasExit("s") {
+		t.Fatalf("Got %+v, expected the gate", gate)
+	}
+}
+
+func TestLoadAreasRejectsUnknownFields(t *testing.T) {
+	testCases := []struct {
+		area string
+		want string
+	}{
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}, "exit": {"east": "a"}, "flags": ["start"]}
+			]}`,
+			want: `unknown field "exit"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}, "exits": {"east": {"to": "a", "hiden": true}}, "flags": ["start"]}
+			]}`,
+			want: `unknown field "hiden"`,
+		},
+	}
+
+	for i, tc := range testCases {
+		_, err := LoadAreas(fstest.MapFS{"area.json": {Data: []byte(tc.area)}})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("Testcase %d: Got %v, expected it to contain %q", i, err, tc.want)
+		}
+	}
+}
+
+func TestLoadAreasValidation(t *testing.T) {
+	testCases := []struct {
+		area string
+		want string
+	}{
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}, "exits": {"east": "b"}, "flags": ["start"]}
+			]}`,
+			want: `room "a" has an exit east to an unknown room "b"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}, "flags": ["start"]},
+				{"id": "b", "coordinate": {"x": 0, "y": 0}}
+			]}`,
+			want: `room "b" has the same coordinate (0, 0) as room "a"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}, "flags": ["start"]},
+				{"id": "b", "coordinate": {"x": 1, "y": 0}, "exits": {"west": "a"}}
+			]}`,
+			want: `room "b" can't be reached from the start room`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "exits": {"n": "b", "north": "b"}, "flags": ["start"]},
+				{"id": "b"}
+			]}`,
+			want: `room "a" has the exit north more than once`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "exits": {"look": "b"}, "flags": ["start"]},
+				{"id": "b"}
+			]}`,
+			want: `room "a" has an exit "look" which is also a command`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}}
+			]}`,
+			want: `exactly one room flagged "start"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "exits": {"north": {"to": "b", "door": {"state": "ajar"}}}, "flags": ["start"]},
+				{"id": "b"}
+			]}`,
+			want: `room "a" has a door north with an unknown state "ajar"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "exits": {"north": {"to": "b", "door": {"state": "locked"}}}, "flags": ["start"]},
+				{"id": "b"}
+			]}`,
+			want: `room "a" has a locked door north without a key`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}, "flags": ["start", "sunny"]}
+			]}`,
+			want: `room "a" has an unknown flag "sunny"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "flags": ["start", "respawn"], "exits": {"north": "b"}},
+				{"id": "b", "flags": ["respawn"], "exits": {"south": "a"}}
+			]}`,
+			want: `there should be at most one room flagged "respawn", found 2`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "flags": ["start"]}
+			], "resets": {"interval": "often"}}`,
+			want: `invalid reset interval "often"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "flags": ["start"]}
+			], "resets": {"rules": [{"spawn": "cat", "put": "hat", "room": "a"}]}}`,
+			want: `reset 1 should have exactly one of spawn, put, give and door`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "flags": ["start"]}
+			], "resets": {"rules": [{"spawn": "cat", "room": "a"}]}}`,
+			want: `reset 1 spawns an unknown mob "cat"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "flags": ["start"]}
+			], "resets": {"rules": [{"put": "hat", "room": "b"}]}}`,
+			want: `reset 1 has a room "b" which is not in the area`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "flags": ["start"], "exits": {"north": "b"}},
+				{"id": "b", "exits": {"south": "a"}}
+			], "resets": {"rules": [{"door": "north", "room": "a", "state": "open"}]}}`,
+			want: `reset 1 has no door north in room "a"`,
+		},
+		{
+			area: `{"name": "a", "mobs": [
+				{"id": "cat", "name": "the cat", "keywords": ["cat"], "stats": {"maxHealth": 1},
+				 "behaviours": ["purring"], "items": ["yarn"]}
+			], "rooms": [
+				{"id": "a", "flags": ["start"], "mobs": ["cat", "dog"]}
+			]}`,
+			want: `mob "cat" has an unknown behaviour "purring"`,
+		},
+		{
+			area: `{"name": "a", "mobs": [
+				{"id": "cat", "name": "the cat", "keywords": ["cat"], "stats": {"maxHealth": 1}}
+			], "rooms": [
+				{"id": "a", "flags": ["start"], "mobs": ["cat", "dog"]}
+			]}`,
+			want: `room "a" has an unknown mob "dog"`,
+		},
+		{
+			area: `{"name": "a", "items": [
+				{"id": "hat", "keywords": ["hat"], "slot": "tail"}
+			], "rooms": [
+				{"id": "a", "flags": ["start"], "items": ["hat"]}
+			]}`,
+			want: `item "hat" has an unknown slot "tail"`,
+		},
+		{
+			area: `{"name": "a", "rooms": [
+				{"id": "a", "coordinate": {"x": 0, "y": 0}, "flags": ["start"]},
+				{"id": "a", "coordinate": {"x": 1, "y": 0}}
+			]}`,
+			want: `room "a" is already defined in area.json`,
+		},
+	}
+
+	for i, tc := range testCases {
+		_, err := LoadAreas(fstest.MapFS{"area.json": {Data: []byte(tc.area)}})
+
+		var invalid ErrInvalidAreas
+		if !errors.As(err, &invalid) {
+			t.Fatalf("Testcase %d: Got %v, expected ErrInvalidAreas", i, err)
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("Testcase %d: Got %q, expected it to contain %q", i, err, tc.want)
+		}
+	}
+}
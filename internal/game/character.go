@@ -10,29 +10,44 @@ type ClientId string
 /*
 character would have command registry
 client would have a link to the character
-
-
 */
 type Character struct {
-	Id             ClientId
-	health, attack int
-	Name           string
-	Coordinate     Coordinate
+	Id     ClientId
+	health int
+	// base stats are the character's own before the equipment and the
+	// effects
+	base       Stats
+	experience int
+	Name       string
+	Room       RoomId
 
 	Reply     func(string)
 	Broadcast func(string)
 
-	state    State
-	commands *CommandRegistry
+	state     State
+	commands  *CommandRegistry
+	inventory []*Item
+	equipment map[EquipSlot]*Item
+	effects   []Effect
+	// opponent is who the character is fighting
+	opponent *Character
+	// mob is the template of a non-player character, nil for the players
+	mob *MobTemplate
+	// home is the room where the mob was spawned
+	home RoomId
+	// wait is the number of ticks until the next timed command can be run
+	wait int
+	// queue has the timed commands given while waiting
+	queue []timedCommand
 }
 
 func NewCharacter(id ClientId, name string /*, reply func(string), broadcast func(string)*/) *Character {
 	ch := &Character{
-		Id:         id,
-		health:     30,
-		attack:     1,
-		Name:       name,
-		Coordinate: Coordinate{X: 0, Y: 0},
+		Id:        id,
+		health:    30,
+		base:      Stats{MaxHealth: 30, Attack: 1},
+		Name:      name,
+		equipment: make(map[EquipSlot]*Item),
 	}
 
 	ch.SetState("idle")
@@ -40,8 +55,77 @@ func NewCharacter(id ClientId, name string /*, reply func(string), broadcast fun
 	return ch
 }
 
-func (c *Character) Tick(timeStep time.Duration, world World) {
+// Data returns the part of the character that is saved
+func (c *Character) Data() CharacterData {
+	inventory := make([]ItemTemplateId, len(c.inventory))
+	for i, item := range c.inventory {
+		inventory[i] = item.TemplateId()
+	}
+	equipment := make(map[EquipSlot]ItemTemplateId)
+	for slot, item := range c.equipment {
+		equipment[slot] = item.TemplateId()
+	}
+
+	return CharacterData{
+		Version:    characterSchemaVersion,
+		Name:       c.Name,
+		Health:     c.health,
+		MaxHealth:  c.base.MaxHealth,
+		Attack:     c.base.Attack,
+		Defense:    c.base.Defense,
+		Experience: c.experience,
+		Room:       c.Room,
+		State:      c.state.state,
+		Inventory:  inventory,
+		Equipment:  equipment,
+	}
+}
+
+// LoadData restores the saved character. The inventory and the equipment are
+// restored by the world as it knows the item templates.
+func (c *Character) LoadData(data CharacterData) {
+	c.Name = data.Name
+	c.health = data.Health
+	c.base = Stats{MaxHealth: data.MaxHealth, Attack: data.Attack, Defense: data.Defense}
+	c.experience = data.Experience
+	c.Room = data.Room
+	if data.State != "" {
+		c.SetState(data.State)
+	}
+}
+
+// HasKey tells if the character carries the key item
+func (c *Character) HasKey(key string) bool {
+	for _, item := range c.inventory {
+		if string(item.TemplateId()) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasItem tells if the character carries or uses an item of the template
+func (c *Character) hasItem(id ItemTemplateId) bool {
+	for _, item := range c.inventory {
+		if item.TemplateId() == id {
+			return true
+		}
+	}
+	for _, item := range c.equipment {
+		if item.TemplateId() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Character) Tick(timeStep time.Duration, world *World) {
+	state, effects := c.state.state, len(c.effects)
 	c.state.Tick(c, world, timeStep)
+	c.updateEffects(timeStep)
+	if c.state.state != state || len(c.effects) != effects {
+		world.characterChanged(c)
+	}
 }
 
 func (c *Character) SetState(state CharacterState) {
@@ -50,6 +134,8 @@ func (c *Character) SetState(state CharacterState) {
 		c.state = CreateIdleState()
 	case smoking:
 		c.state = CreateSmokingPipeState()
+	case fighting:
+		c.state = CreateFightingState()
 	default:
 		fmt.Printf("unknown state: %s", state)
 	}
@@ -62,18 +148,19 @@ func (c Character) String() string {
 type CharacterState string
 
 const (
-	idle    CharacterState = "idle"
-	smoking CharacterState = "smoking"
+	idle     CharacterState = "idle"
+	smoking  CharacterState = "smoking"
+	fighting CharacterState = "fighting"
 )
 
 type State struct {
 	state       CharacterState
 	timeLeft    time.Duration
 	description string
-	function    func(*Character, World, time.Duration)
+	function    func(*Character, *World, time.Duration)
 }
 
-func (state *State) Tick(ch *Character, world World, timeStep time.Duration) {
+func (state *State) Tick(ch *Character, world *World, timeStep time.Duration) {
 	state.function(ch, world, timeStep)
 }
 
@@ -82,7 +169,10 @@ func CreateIdleState() State {
 		state:       idle,
 		timeLeft:    time.Second,
 		description: "X is standing idle",
-		function: func(ch *Character, world World, timeStep time.Duration) {
+		function: func(ch *Character, world *World, timeStep time.Duration) {
+			if ch.IsMob() {
+				world.runMobBehaviours(ch)
+			}
 		},
 	}
 }
@@ -92,7 +182,7 @@ func CreateSmokingPipeState() State {
 		state:       smoking,
 		timeLeft:    time.Second * 5,
 		description: "X is smoking a pipe",
-		function: func(ch *Character, world World, timeStep time.Duration) {
+		function: func(ch *Character, world *World, timeStep time.Duration) {
 			ch.state.timeLeft -= timeStep
 			if ch.state.timeLeft > 0 {
 				ch.Broadcast("The pipe puffs\n")
@@ -113,3 +203,18 @@ func CreateSmokingPipeState() State {
 		},
 	}
 }
+
+// CreateFightingState resolves a combat round against the opponent on every
+// tick
+func CreateFightingState() State {
+	return State{
+		state:       fighting,
+		description: "X is fighting",
+		function: func(ch *Character, world *World, timeStep time.Duration) {
+			world.combatRound(ch)
+			if ch.IsMob() && ch.state.state == fighting {
+				world.runMobBehaviours(ch)
+			}
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// characterSchemaVersion is bumped every time CharacterData changes in a way
+// that needs the old files to be migrated. Add the migration from the
+// previous version to characterMigrations at the same time.
+const characterSchemaVersion = 5
+
+var ErrCharacterNotFound = errors.New("character not found")
+
+// CharacterData is the part of the character that is stored between sessions
+type CharacterData struct {
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Health     int    `json:"health"`
+	MaxHealth  int    `json:"maxHealth"`
+	Attack     int    `json:"attack"`
+	Defense    int    `json:"defense"`
+	Experience int    `json:"experience"`
+	Room       RoomId `json:"room"`
+	// Coordinate is only set in the version 1 saves which didn't have the
+	// room id yet
+	Coordinate *Coordinate    `json:"coordinate,omitempty"`
+	State      CharacterState `json:"state"`
+	// Inventory has the template ids of the carried items
+	Inventory []ItemTemplateId `json:"inventory"`
+	// Equipment has the template ids of the used items by the slot
+	Equipment map[EquipSlot]ItemTemplateId `json:"equipment"`
+}
+
+type CharacterStore interface {
+	// LoadCharacter returns ErrCharacterNotFound if there's no character
+	// by the name
+	LoadCharacter(name string) (CharacterData, error)
+	SaveCharacter(data CharacterData) error
+}
+
+type ErrUnsupportedVersion struct {
+	version int
+}
+
+func (e ErrUnsupportedVersion) Error() string {
+	return fmt.Sprintf("unsupported schema version %d", e.version)
+}
+
+// characterMigration migrates the stored fields from one version to the next
+type characterMigration func(fields map[string]interface{})
+
+// characterMigrations are keyed by the version they migrate from
+var characterMigrations = map[int]characterMigration{
+	// version 2 replaced the coordinate with the room id. The coordinate
+	// is kept and the room is looked up by it on login.
+	1: func(fields map[string]interface{}) {},
+	// version 3 added the inventory
+	2: func(fields map[string]interface{}) {
+		fields["inventory"] = []interface{}{}
+	},
+	// version 4 added the equipment and the maximum health and defense
+	3: func(fields map[string]interface{}) {
+		fields["maxHealth"] = 30
+		fields["defense"] = 0
+		fields["equipment"] = map[string]interface{}{}
+	},
+	// version 5 added the experience
+	4: func(fields map[string]interface{}) {
+		fields["experience"] = 0
+	},
+}
+
+func migrateCharacter(
+	fields map[string]interface{},
+	targetVersion int,
+	migrations map[int]characterMigration,
+) error {
+	version := 0
+	if v, ok := fields["version"].(float64); ok {
+		version = int(v)
+	}
+
+	if version > targetVersion {
+		return ErrUnsupportedVersion{version: version}
+	}
+	for ; version < targetVersion; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return ErrUnsupportedVersion{version: version}
+		}
+		migration(fields)
+	}
+	fields["version"] = targetVersion
+
+	return nil
+}
+
+type MemoryCharacterStore struct {
+	characters map[string]CharacterData
+}
+
+func NewMemoryCharacterStore() *MemoryCharacterStore {
+	return &MemoryCharacterStore{characters: make(map[string]CharacterData)}
+}
+
+func (s *MemoryCharacterStore) LoadCharacter(name string) (CharacterData, error) {
+	data, ok := s.characters[strings.ToLower(name)]
+	if !ok {
+		return CharacterData{}, ErrCharacterNotFound
+	}
+	return data, nil
+}
+
+func (s *MemoryCharacterStore) SaveCharacter(data CharacterData) error {
+	s.characters[strings.ToLower(data.Name)] = data
+	return nil
+}
+
+// FileCharacterStore stores every character as a JSON file in the directory
+type FileCharacterStore struct {
+	dir string
+}
+
+func NewFileCharacterStore(dir string) (*FileCharacterStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileCharacterStore{dir: dir}, nil
+}
+
+func (s *FileCharacterStore) path(name string) (string, error) {
+	if !IsValidName(name) {
+		return "", ErrInvalidName{name: name}
+	}
+	return filepath.Join(s.dir, strings.ToLower(name)+".json"), nil
+}
+
+func (s *FileCharacterStore) LoadCharacter(name string) (CharacterData, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return CharacterData{}, err
+	}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return CharacterData{}, ErrCharacterNotFound
+	}
+	if err != nil {
+		return CharacterData{}, err
+	}
+
+	return decodeCharacter(contents, characterSchemaVersion, characterMigrations)
+}
+
+func decodeCharacter(
+	contents []byte,
+	targetVersion int,
+	migrations map[int]characterMigration,
+) (CharacterData, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(contents, &fields); err != nil {
+		return CharacterData{}, err
+	}
+	if err := migrateCharacter(fields, targetVersion, migrations); err != nil {
+		return CharacterData{}, err
+	}
+
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return CharacterData{}, err
+	}
+	var data CharacterData
+	err = json.Unmarshal(migrated, &data)
+	return data, err
+}
+
+func (s *FileCharacterStore) SaveCharacter(data CharacterData) error {
+	path, err := s.path(data.Name)
+	if err != nil {
+		return err
+	}
+
+	data.Version = characterSchemaVersion
+	contents, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, contents)
+}
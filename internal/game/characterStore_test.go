@@ -0,0 +1,124 @@
+package game
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileCharacterStore(t *testing.T) {
+	store, err := NewFileCharacterStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.LoadCharacter("abel"); !errors.Is(err, ErrCharacterNotFound) {
+		t.Fatalf("Got %v, expected ErrCharacterNotFound", err)
+	}
+
+	ch := NewCharacter("client", "Abel")
+	ch.health = 12
+	ch.Room = "another-room"
+	ch.SetState(smoking)
+	if err := store.SaveCharacter(ch.Data()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := store.LoadCharacter("abel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewCharacter("client", "abel")
+	loaded.LoadData(data)
+	if loaded.Name != "Abel" || loaded.health != 12 || loaded.base.Attack != 1 {
+		t.Fatalf("Got %+v, expected %+v", loaded.Data(), ch.Data())
+	}
+	if loaded.Room != "another-room" || loaded.state.state != smoking {
+		t.Fatalf("Got %+v, expected %+v", loaded.Data(), ch.Data())
+	}
+}
+
+func TestVersion1CharacterIsPlacedByCoordinate(t *testing.T) {
+	contents := []byte(`{"version": 1, "name": "abel", "health": 30, "coordinate": {"X": 1, "Y": 0}}`)
+	data, err := decodeCharacter(contents, characterSchemaVersion, characterMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryCharacterStore()
+	store.SaveCharacter(data)
+	w := NewWorld(WithCharacterStore(store))
+	account, _, _ := newTestAccount(w, "client")
+	w.enterGame(account, "abel")
+
+	if ch := w.GetCharacter("client"); ch.Room != "another-room" {
+		t.Fatalf("Got %s, expected the room at the coordinate", ch.Room)
+	}
+}
+
+func TestCharacterWhichFailsToLoadIsNotPlayed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileCharacterStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "bella.json")
+	saved := []byte(`{"version": 99, "name": "Bella", "experience": 1234}`)
+	if err := os.WriteFile(path, saved, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	accounts := NewMemoryAccountStore()
+	accounts.SaveAccount(AccountData{Name: "abel", Characters: []string{"Bella"}})
+	w := NewWorld(WithAccountStore(accounts), WithCharacterStore(store))
+
+	var replies []string
+	w.ClientJoined("client", &fakeConnection{account: "abel"}, func(message string) { replies = append(replies, message) })
+	w.PassMessageToClient("bella\r\n", "client")
+	w.Step()
+
+	if !strings.Contains(lastMessage(&replies), "Bella can't be loaded") {
+		t.Fatalf("Got %q, expected the login to be refused", replies)
+	}
+	if account := w.GetAccount("client"); account.loginState != loginSelectCharacter || account.loggedInCharacter != nil {
+		t.Fatal("the account should still select the character")
+	}
+
+	w.ClientDisconnected("client")
+	w.SaveAllCharacters()
+	w.Step()
+	if contents, _ := os.ReadFile(path); string(contents) != string(saved) {
+		t.Fatalf("Got %s, expected the save to be kept", contents)
+	}
+}
+
+func TestCharacterMigrations(t *testing.T) {
+	migrations := map[int]characterMigration{
+		1: func(fields map[string]interface{}) {
+			fields["health"] = fields["hp"]
+			delete(fields, "hp")
+		},
+		2: func(fields map[string]interface{}) {
+			fields["attack"] = 1
+		},
+	}
+
+	data, err := decodeCharacter([]byte(`{"version": 1, "name": "abel", "hp": 20}`), 3, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != 3 || data.Health != 20 || data.Attack != 1 {
+		t.Fatalf("migrations were not run: %+v", data)
+	}
+
+	var unsupported ErrUnsupportedVersion
+	_, err = decodeCharacter([]byte(`{"version": 4, "name": "abel"}`), 3, migrations)
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("Got %v, expected ErrUnsupportedVersion for a newer version", err)
+	}
+	_, err = decodeCharacter([]byte(`{"version": 0, "name": "abel"}`), 3, migrations)
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("Got %v, expected ErrUnsupportedVersion for a missing migration", err)
+	}
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock drives the game loop. The real clock ticks with the wall time and
+// the manual one only when it's advanced.
+type Clock interface {
+	NewTicker(interval time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// WithClock sets the clock of the game loop instead of the real one
+func WithClock(clock Clock) WorldOption {
+	return func(w *World) {
+		w.clock = clock
+	}
+}
+
+type realClock struct{}
+
+func (realClock) NewTicker(interval time.Duration) Ticker {
+	return realTicker{ticker: time.NewTicker(interval)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// ManualClock is moved forward by calling Advance. It's meant for the tests.
+type ManualClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+}
+
+func NewManualClock() *ManualClock {
+	return &ManualClock{now: time.Unix(0, 0)}
+}
+
+func (c *ManualClock) NewTicker(interval time.Duration) Ticker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ticker := &manualTicker{
+		clock:    c,
+		c:        make(chan time.Time),
+		interval: interval,
+		next:     c.now.Add(interval),
+	}
+	c.tickers = append(c.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the clock forward and delivers the ticks that happened in
+// between. It blocks until the tickers' readers have received the ticks.
+func (c *ManualClock) Advance(duration time.Duration) {
+	c.mutex.Lock()
+	c.now = c.now.Add(duration)
+	now := c.now
+	tickers := append([]*manualTicker{}, c.tickers...)
+	c.mutex.Unlock()
+
+	for _, ticker := range tickers {
+		for !ticker.next.After(now) {
+			ticker.c <- ticker.next
+			ticker.next = ticker.next.Add(ticker.interval)
+		}
+	}
+}
+
+type manualTicker struct {
+	clock    *ManualClock
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			break
+		}
+	}
+}
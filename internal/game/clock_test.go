@@ -0,0 +1,78 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStepRunsQueuedActionsAndTicksOnce(t *testing.T) {
+	w := NewWorld()
+	account, _, replies := newTestAccount(w, "client")
+	ch := NewCharacter("client", "abel")
+	ch.commands = NewInGameCommandRegistry()
+	ch.Reply = account.output
+	ch.Broadcast = account.output
+	account.loggedInCharacter = ch
+	w.InsertCharacterOnConnect(ch)
+
+	w.PassMessageToClient("smoke start", "client")
+	if len(*replies) != 0 {
+		t.Fatal("the command should wait for the step")
+	}
+
+	w.Step()
+	if (*replies)[0] != "You started to smoke your pipe\n" {
+		t.Fatalf("Got %q", *replies)
+	}
+	if len(*replies) != 2 || (*replies)[1] != "The pipe puffs\n" {
+		t.Fatalf("Got %q, expected exactly one tick", *replies)
+	}
+
+	for i := 0; i < 4; i++ {
+		w.Step()
+	}
+	if lastMessage(replies) != "You run out of tobacco and stopped smoking the pipe\n" {
+		t.Fatalf("Got %q", lastMessage(replies))
+	}
+	if ch.state.state != idle {
+		t.Fatal("the pipe should have run out on the fifth tick")
+	}
+}
+
+func TestGameLoopTicksWithTheClock(t *testing.T) {
+	clock := NewManualClock()
+	w := NewWorld(WithClock(clock))
+	var ticks []string
+	ch := NewCharacter("client", "abel")
+	ch.Broadcast = func(message string) { ticks = append(ticks, message) }
+	ch.SetState(smoking)
+	w.InsertCharacterOnConnect(ch)
+
+	go w.RunGameLoop()
+	waitForTicker(t, clock)
+
+	clock.Advance(500 * time.Millisecond)
+	clock.Advance(2500 * time.Millisecond)
+	w.Stop()
+
+	if len(ticks) != 3 {
+		t.Fatalf("Got %q, expected three ticks", ticks)
+	}
+}
+
+func waitForTicker(t *testing.T, clock *ManualClock) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		clock.mutex.Lock()
+		tickers := len(clock.tickers)
+		clock.mutex.Unlock()
+		if tickers > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the game loop to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
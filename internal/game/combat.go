@@ -0,0 +1,194 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Random is the source of the dice rolls. *rand.Rand satisfies it and the
+// tests use a fixed sequence.
+type Random interface {
+	Intn(n int) int
+}
+
+// WithRandom sets the random source used in the combat
+func WithRandom(random Random) WorldOption {
+	return func(w *World) {
+		w.random = random
+	}
+}
+
+const (
+	baseHitChance = 60
+	minHitChance  = 5
+	maxHitChance  = 95
+	// fleeChance is the percentage of the flee attempts that succeed
+	fleeChance = 66
+)
+
+// hitChance is the percentage chance of the attacker hitting the defender.
+// Every point of attack over the defense makes it more likely.
+func hitChance(attacker, defender Stats) int {
+	chance := baseHitChance + 5*(attacker.Attack-defender.Defense)
+	if chance < minHitChance {
+		return minHitChance
+	}
+	if chance > maxHitChance {
+		return maxHitChance
+	}
+	return chance
+}
+
+// rollAttack resolves a single attack. Zero damage is a miss.
+func rollAttack(attacker, defender Stats, random Random) int {
+	if random.Intn(100) >= hitChance(attacker, defender) {
+		return 0
+	}
+	damage := 1 + random.Intn(attacker.Attack+1) - defender.Defense/2
+	if damage < 1 {
+		damage = 1
+	}
+	return damage
+}
+
+// startFight makes the character attack the target. The target fights back
+// unless it's already fighting someone else.
+func (w *World) startFight(ch, target *Character) {
+	w.characterChanged(ch)
+	w.characterChanged(target)
+	ch.opponent = target
+	ch.SetState(fighting)
+	if target.opponent == nil {
+		target.opponent = ch
+		target.SetState(fighting)
+	}
+}
+
+// stopFighting ends the fights of the character. Those who were fighting it
+// turn to the next attacker in the room, if any.
+func (w *World) stopFighting(ch *Character) {
+	w.characterChanged(ch)
+	ch.opponent = nil
+	if ch.state.state == fighting {
+		ch.SetState(idle)
+	}
+
+	for _, other := range w.allCharacters() {
+		if other.opponent != ch {
+			continue
+		}
+		w.characterChanged(other)
+		other.opponent = nil
+		for _, attacker := range w.charactersIn(other.Room) {
+			if attacker.opponent == other {
+				other.opponent = attacker
+				break
+			}
+		}
+		if other.opponent == nil {
+			other.SetState(idle)
+		}
+	}
+}
+
+func (w *World) isInRoom(ch *Character, room RoomId) bool {
+	return w.occupants[room][ch.Id] == ch
+}
+
+// combatRound is run every tick for the fighting characters
+func (w *World) combatRound(ch *Character) {
+	target := ch.opponent
+	if target == nil || !w.isInRoom(target, ch.Room) {
+		w.stopFighting(ch)
+		return
+	}
+
+	damage := rollAttack(ch.Stats(), target.Stats(), w.random)
+	if damage == 0 {
+		ch.Broadcast(fmt.Sprintf("You miss %s\n", target.Name))
+		target.Broadcast(fmt.Sprintf("%s misses you\n", ch.Name))
+		w.broadcastToBystanders(ch, target, fmt.Sprintf("%s misses %s\n", ch.Name, target.Name))
+		return
+	}
+
+	target.health -= damage
+	w.characterChanged(target)
+	ch.Broadcast(fmt.Sprintf("You hit %s for %d damage\n", target.Name, damage))
+	target.Broadcast(fmt.Sprintf("%s hits you for %d damage\n", ch.Name, damage))
+	w.broadcastToBystanders(ch, target, fmt.Sprintf("%s hits %s\n", ch.Name, target.Name))
+
+	if target.health <= 0 {
+		w.killCharacter(target, ch)
+	}
+}
+
+func (w *World) broadcastToBystanders(ch, target *Character, message string) {
+	for _, other := range w.OtherCharactersInRoom(ch) {
+		if other != target {
+			other.Broadcast(message)
+		}
+	}
+}
+
+func KillCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		target := world.characterInRoomByName(ch, command.contents)
+		switch {
+		case command.contents == "":
+			ch.Reply("Who do you want to attack?\n")
+		case strings.EqualFold(command.contents, ch.Name):
+			ch.Reply("You can't attack yourself\n")
+		case target == nil:
+			ch.Reply(fmt.Sprintf("There's no %s here\n", command.contents))
+		case ch.opponent != nil:
+			ch.Reply(fmt.Sprintf("You are already fighting %s\n", ch.opponent.Name))
+		default:
+			world.startFight(ch, target)
+			ch.Reply(fmt.Sprintf("You attack %s!\n", target.Name))
+			target.Broadcast(fmt.Sprintf("%s attacks you!\n", ch.Name))
+			world.broadcastToBystanders(ch, target, fmt.Sprintf("%s attacks %s!\n", ch.Name, target.Name))
+		}
+
+		return nil
+	}
+}
+
+func FleeCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		if ch.opponent == nil {
+			ch.Reply("You are not fighting anyone\n")
+			return nil
+		}
+
+		var exits []*Exit
+		for _, exit := range world.rooms[ch.Room].exits {
+			if exit.IsPassable() && !exit.hidden {
+				exits = append(exits, exit)
+			}
+		}
+		if len(exits) == 0 {
+			ch.Reply("There's nowhere to flee!\n")
+			return nil
+		}
+		if world.random.Intn(100) >= fleeChance {
+			ch.Reply("You fail to get away!\n")
+			world.BroadcastToOtherCharactersInRoom(ch, fmt.Sprintf("%s tries to flee\n", ch.Name))
+			return nil
+		}
+
+		exit := exits[world.random.Intn(len(exits))]
+		world.stopFighting(ch)
+		world.BroadcastToOtherCharactersInRoom(ch, fmt.Sprintf("%s flees %s\n", ch.Name, exit.keyword))
+		world.MoveCharacterInDirection(ch, exit.keyword)
+		ch.Reply(fmt.Sprintf("You flee %s\n%s\n", exit.keyword, world.DescribeRoom(ch.Room)))
+		world.BroadcastToOtherCharactersInRoom(ch, fmt.Sprintf("%s arrives in a hurry\n", ch.Name))
+
+		return nil
+	}
+}
+
+func newDefaultRandom() Random {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
@@ -0,0 +1,141 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+// scriptedRandom returns the rolls in order
+type scriptedRandom struct {
+	rolls []int
+}
+
+func (r *scriptedRandom) Intn(n int) int {
+	if len(r.rolls) == 0 {
+		panic("out of rolls")
+	}
+	roll := r.rolls[0]
+	r.rolls = r.rolls[1:]
+	return roll % n
+}
+
+func TestRollAttack(t *testing.T) {
+	testCases := []struct {
+		attacker, defender Stats
+		rolls              []int
+		damage             int
+	}{
+		{attacker: Stats{Attack: 1}, defender: Stats{}, rolls: []int{65, 0}, damage: 0},
+		{attacker: Stats{Attack: 1}, defender: Stats{}, rolls: []int{64, 1}, damage: 2},
+		{attacker: Stats{Attack: 4}, defender: Stats{}, rolls: []int{79, 4}, damage: 5},
+		{attacker: Stats{Attack: 4}, defender: Stats{Defense: 4}, rolls: []int{59, 0}, damage: 1},
+		{attacker: Stats{Attack: 0}, defender: Stats{Defense: 50}, rolls: []int{5, 0}, damage: 0},
+		{attacker: Stats{Attack: 50}, defender: Stats{}, rolls: []int{95, 0}, damage: 0},
+	}
+	for i, tc := range testCases {
+		damage := rollAttack(tc.attacker, tc.defender, &scriptedRandom{rolls: tc.rolls})
+		if damage != tc.damage {
+			t.Fatalf("Testcase %d: Got %d, expected %d", i, damage, tc.damage)
+		}
+	}
+}
+
+func TestFightIsResolvedOnTicks(t *testing.T) {
+	random := &scriptedRandom{}
+	w := NewWorld(WithRandom(random))
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "room")
+	bella, bellaMessages := newTestCharacter(w, "bella", "bella", "room")
+	_, cecilMessages := newTestCharacter(w, "cecil", "cecil", "room")
+
+	runInput(t, w, abel, "kill bella")
+	if lastMessage(abelMessages) != "You attack bella!\n" ||
+		lastMessage(bellaMessages) != "abel attacks you!\n" ||
+		lastMessage(cecilMessages) != "abel attacks bella!\n" {
+		t.Fatal("everyone should see the attack")
+	}
+	if bella.opponent != abel || bella.state.state != fighting {
+		t.Fatal("bella should fight back")
+	}
+
+	// abel hits for 2, bella misses
+	random.rolls = []int{0, 1, 99}
+	w.UpdateCharacterStates(time.Second)
+	if bella.health != 28 {
+		t.Fatalf("Got %d, expected bella to take damage", bella.health)
+	}
+	if (*abelMessages)[len(*abelMessages)-2] != "You hit bella for 2 damage\n" ||
+		lastMessage(abelMessages) != "bella misses you\n" {
+		t.Fatalf("Got %q", *abelMessages)
+	}
+	if (*cecilMessages)[len(*cecilMessages)-2] != "abel hits bella\n" ||
+		lastMessage(cecilMessages) != "bella misses abel\n" {
+		t.Fatalf("Got %q", *cecilMessages)
+	}
+
+	runInput(t, w, bella, "north")
+	if lastMessage(bellaMessages) != "You are fighting! Try to flee\n" {
+		t.Fatalf("Got %q", lastMessage(bellaMessages))
+	}
+
+	bella.health = 2
+	random.rolls = []int{0, 1}
+	w.UpdateCharacterStates(time.Second)
+	if abel.opponent != nil || bella.opponent != nil || abel.state.state != idle {
+		t.Fatal("the fight should end on death")
+	}
+	if bella.health != 15 || bella.Room != "room" {
+		t.Fatalf("Got %+v, expected bella to wake up in the start room", bella.Data())
+	}
+}
+
+func TestFleeing(t *testing.T) {
+	random := &scriptedRandom{}
+	w := NewWorld(WithRandom(random))
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "room")
+	bella, bellaMessages := newTestCharacter(w, "bella", "bella", "room")
+
+	runInput(t, w, bella, "flee")
+	if lastMessage(bellaMessages) != "You are not fighting anyone\n" {
+		t.Fatalf("Got %q", lastMessage(bellaMessages))
+	}
+	w.Step()
+	w.Step()
+
+	runInput(t, w, abel, "kill bella")
+	random.rolls = []int{99}
+	runInput(t, w, bella, "flee")
+	if lastMessage(bellaMessages) != "You fail to get away!\n" || bella.Room != "room" {
+		t.Fatalf("Got %q", lastMessage(bellaMessages))
+	}
+
+	// the lag of the failed attempt is over
+	bella.wait = 0
+	random.rolls = []int{0, 0}
+	runInput(t, w, bella, "flee")
+	if bella.Room != "another-room" {
+		t.Fatal("bella should have fled east")
+	}
+	if lastMessage(abelMessages) != "bella flees east\n" {
+		t.Fatalf("Got %q", lastMessage(abelMessages))
+	}
+	if abel.opponent != nil || bella.opponent != nil || abel.state.state != idle {
+		t.Fatal("the fight should end when fleeing")
+	}
+}
+
+func TestDisconnectEndsTheFight(t *testing.T) {
+	w := NewWorld(WithRandom(&scriptedRandom{}))
+	abel, _ := newTestCharacter(w, "abel", "abel", "room")
+	bella, _ := newTestCharacter(w, "bella", "bella", "room")
+	runInput(t, w, abel, "kill bella")
+
+	account, _, _ := newTestAccount(w, "bella")
+	account.loggedInCharacter = bella
+	if err := DisconnectAction(account)(w); err != nil {
+		t.Fatal(err)
+	}
+
+	if abel.opponent != nil || abel.state.state != idle {
+		t.Fatal("abel should stop fighting")
+	}
+}
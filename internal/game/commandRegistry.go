@@ -31,14 +31,52 @@ func NewInGameCommandRegistry() *CommandRegistry {
 	return NewCommandRegistry(inGameCommandInfos)
 }
 
+// NewAdminCommandRegistry has the admin commands in addition to the in-game
+// ones
+func NewAdminCommandRegistry() *CommandRegistry {
+	infos := append([]CommandInfo{}, inGameCommandInfos...)
+	return NewCommandRegistry(append(infos, adminCommandInfos...))
+}
+
 func (c *CommandRegistry) InputToAction(line string, ch *Character) WorldAction {
 	command := c.parseCommand(line)
 
 	info, ok := c.commandInfos[command.command]
-	if ok {
-		return info.action(command, ch)
-	} else {
-		return UnknownCommandAction(command, ch)
+	if !ok {
+		return characterAction(ch, line, UnknownCommandAction(command, ch))
+	}
+
+	action := characterAction(ch, line, info.action(command, ch))
+	if info.mode == Timed {
+		return timedAction(ch, action, info.lag)
+	}
+	return action
+}
+
+type timedCommand struct {
+	action WorldAction
+	lag    int
+}
+
+// maxQueuedCommands is how many timed commands can wait for their turn
+const maxQueuedCommands = 3
+
+// timedAction runs the action right away unless the character is still
+// waiting after the previous timed command. Then the action is queued and
+// run on the tick the wait is over. The command is refused if the queue is
+// full.
+func timedAction(ch *Character, action WorldAction, lag int) WorldAction {
+	return func(w *World) error {
+		if ch.wait > 0 || len(ch.queue) > 0 {
+			if len(ch.queue) >= maxQueuedCommands {
+				ch.Reply("You are busy\n")
+				return nil
+			}
+			ch.queue = append(ch.queue, timedCommand{action: action, lag: lag})
+			return nil
+		}
+		ch.wait = lag
+		return action(w)
 	}
 }
 
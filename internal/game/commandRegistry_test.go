@@ -1,6 +1,10 @@
 package game
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestParsingInGameCommands(t *testing.T) {
 	testCases := []struct {
@@ -29,3 +33,75 @@ func TestParsingInGameCommands(t *testing.T) {
 		}
 	}
 }
+
+func TestInstantCommandsDontWaitForTheTick(t *testing.T) {
+	clock := NewManualClock()
+	w := NewWorld(WithClock(clock))
+	replies := make(chan string, 1)
+	ch := NewCharacter("client", "abel")
+	ch.commands = NewInGameCommandRegistry()
+	ch.Reply = func(message string) { replies <- message }
+	w.InsertCharacterOnConnect(ch)
+	account, _, _ := newTestAccount(w, "client")
+	account.loggedInCharacter = ch
+	account.loginState = loginPlaying
+
+	go w.RunGameLoop()
+	defer w.Stop()
+
+	// the clock is never advanced so there are no ticks
+	w.PassMessageToClient("look\r\n", "client")
+	select {
+	case reply := <-replies:
+		if !strings.HasPrefix(reply, "You look around") {
+			t.Fatalf("Got %q", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("look should be run without a tick")
+	}
+}
+
+func TestTimedCommandsWaitForTheLag(t *testing.T) {
+	w := NewWorld()
+	abel, messages := newTestCharacter(w, "abel", "abel", "room")
+
+	runInput(t, w, abel, "east")
+	if abel.Room != "another-room" {
+		t.Fatal("the first move should be run right away")
+	}
+
+	runInput(t, w, abel, "west")
+	runInput(t, w, abel, "look")
+	if abel.Room != "another-room" {
+		t.Fatal("the second move should wait for the lag")
+	}
+	if !strings.HasPrefix(lastMessage(messages), "You look around") {
+		t.Fatalf("Got %q, expected look to be run while waiting", lastMessage(messages))
+	}
+
+	w.Step()
+	if abel.Room != "room" {
+		t.Fatal("the queued move should be run on the tick")
+	}
+}
+
+func TestTimedCommandsAreQueuedUpToTheLimit(t *testing.T) {
+	w := NewWorld()
+	abel, messages := newTestCharacter(w, "abel", "abel", "room")
+
+	runInput(t, w, abel, "east")
+	for i := 0; i < maxQueuedCommands; i++ {
+		runInput(t, w, abel, "west")
+	}
+	if len(abel.queue) != maxQueuedCommands {
+		t.Fatalf("Got %d, expected %d queued commands", len(abel.queue), maxQueuedCommands)
+	}
+
+	runInput(t, w, abel, "west")
+	if len(abel.queue) != maxQueuedCommands {
+		t.Fatalf("Got %d, expected the command to be refused", len(abel.queue))
+	}
+	if lastMessage(messages) != "You are busy\n" {
+		t.Fatalf("Got %q, expected the character to be busy", lastMessage(messages))
+	}
+}
@@ -2,6 +2,8 @@ package game
 
 import "fmt"
 
+// Coordinate is the location of a room on the map. It's only used for the
+// layout, the rooms are connected by their exits.
 type Coordinate struct {
 	X, Y int
 }
@@ -13,18 +15,3 @@ func NewCoordinate(x, y int) Coordinate {
 func (l Coordinate) String() string {
 	return fmt.Sprintf("(%d, %d)", l.X, l.Y)
 }
-
-func CoordinateInDirection(location Coordinate, direction Direction) Coordinate {
-	switch direction {
-	case West:
-		location.X--
-	case East:
-		location.X++
-	case North:
-		location.Y--
-	case South:
-		location.Y++
-	}
-
-	return location
-}
@@ -0,0 +1,111 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultCorpseDecayTicks = 300
+	defaultDeathPenalty     = 10
+	// respawnHealthPercent is how much of the maximum health the character
+	// has after the respawn
+	respawnHealthPercent = 50
+	killExperience       = 10
+)
+
+// WithCorpseDecay sets after how many ticks the corpses rot away
+func WithCorpseDecay(ticks int) WorldOption {
+	return func(w *World) {
+		w.corpseDecayTicks = ticks
+	}
+}
+
+// WithDeathPenalty sets the percentage of the experience lost on death. Zero
+// turns the penalty off.
+func WithDeathPenalty(percent int) WorldOption {
+	return func(w *World) {
+		w.deathPenalty = percent
+	}
+}
+
+// newCorpse creates a corpse holding the items of the character
+func (w *World) newCorpse(ch *Character) *Item {
+	w.nextItemId++
+	corpse := &Item{
+		id: w.nextItemId,
+		template: &ItemTemplate{
+			id:       "corpse",
+			keywords: []string{"corpse", strings.ToLower(ch.Name)},
+			short:    fmt.Sprintf("the corpse of %s", ch.Name),
+			long:     fmt.Sprintf("The corpse of %s lies here.", ch.Name),
+			flags:    []ItemFlag{NoTake},
+		},
+		decay: w.corpseDecayTicks,
+	}
+
+	corpse.contents = append(corpse.contents, ch.inventory...)
+	ch.inventory = nil
+	for _, slot := range equipSlots {
+		if item, ok := ch.equipment[slot]; ok {
+			corpse.contents = append(corpse.contents, item)
+			delete(ch.equipment, slot)
+		}
+	}
+	return corpse
+}
+
+// killCharacter leaves the corpse of the victim to the room and respawns the
+// victim with reduced health. Dead mobs are gone until the area is reset.
+func (w *World) killCharacter(victim, killer *Character) {
+	w.stopFighting(victim)
+	w.characterChanged(killer)
+	w.characterChanged(victim)
+
+	killer.Broadcast(fmt.Sprintf("You killed %s!\n", victim.Name))
+	killer.experience += killExperience
+	killer.Broadcast(fmt.Sprintf("You gain %d experience\n", killExperience))
+	victim.Broadcast(fmt.Sprintf("You were killed by %s!\n", killer.Name))
+	w.broadcastToBystanders(killer, victim, fmt.Sprintf("%s killed %s!\n", killer.Name, victim.Name))
+
+	room := w.rooms[victim.Room]
+	room.items = append(room.items, w.newCorpse(victim))
+	if victim.IsMob() {
+		w.RemoveCharacterOnDisconnect(victim)
+		return
+	}
+
+	if lost := victim.experience * w.deathPenalty / 100; lost > 0 {
+		victim.experience -= lost
+		victim.Broadcast(fmt.Sprintf("You lose %d experience\n", lost))
+	}
+
+	victim.SetState(idle)
+	victim.effects = nil
+	victim.health = victim.Stats().MaxHealth * respawnHealthPercent / 100
+	if victim.health < 1 {
+		victim.health = 1
+	}
+	w.MoveCharacterToRoom(victim, w.respawnRoom)
+	victim.Broadcast(fmt.Sprintf("You wake up\n%s\n", w.DescribeRoom(victim.Room)))
+	w.BroadcastToOtherCharactersInRoom(victim, fmt.Sprintf("%s appears\n", victim.Name))
+}
+
+// UpdateItems rots the corpses away. Their contents are left in the room.
+func (w *World) UpdateItems() {
+	for _, room := range w.rooms {
+		for _, item := range append([]*Item{}, room.items...) {
+			if item.decay == 0 {
+				continue
+			}
+			item.decay--
+			if item.decay > 0 {
+				continue
+			}
+
+			room.items = removeItem(room.items, item)
+			room.items = append(room.items, item.contents...)
+			w.BroadcastToRoom(room.id, fmt.Sprintf("%s rots away\n", capitalize(item.Short())))
+		}
+	}
+}
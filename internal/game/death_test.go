@@ -0,0 +1,100 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+const arenaArea = `{
+	"name": "arena",
+	"items": [
+		{"id": "sword", "keywords": ["sword"], "short": "a sword", "weight": 5,
+		 "slot": "weapon", "stats": {"attack": 3}},
+		{"id": "apple", "keywords": ["apple"], "short": "an apple", "weight": 1}
+	],
+	"rooms": [
+		{"id": "arena", "title": "Arena", "flags": ["start"], "exits": {"north": "temple"}},
+		{"id": "temple", "title": "Temple", "flags": ["respawn"], "exits": {"south": "arena"}}
+	]
+}`
+
+func giveItem(t *testing.T, w *World, ch *Character, id ItemTemplateId) *Item {
+	t.Helper()
+	item, err := w.NewItem(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.inventory = append(ch.inventory, item)
+	return item
+}
+
+func TestDeathLeavesCorpseAndRespawns(t *testing.T) {
+	w := newTestWorld(t, []string{arenaArea}, WithDeathPenalty(10))
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "arena")
+	bella, bellaMessages := newTestCharacter(w, "bella", "bella", "arena")
+	giveItem(t, w, bella, "apple")
+	giveItem(t, w, bella, "sword")
+	runInput(t, w, bella, "wield sword")
+	bella.experience = 50
+
+	w.killCharacter(bella, abel)
+
+	if bella.Room != "temple" || bella.health != 15 {
+		t.Fatalf("Got %+v, expected bella to respawn in the temple with half health", bella.Data())
+	}
+	if bella.experience != 45 || abel.experience != killExperience {
+		t.Fatalf("Got %d and %d experience", bella.experience, abel.experience)
+	}
+	if len(bella.inventory) != 0 || len(bella.equipment) != 0 || bella.Stats().Attack != 1 {
+		t.Fatal("bella should have lost her items")
+	}
+	if !containsMessage(bellaMessages, "You were killed by abel!\n") ||
+		!containsMessage(abelMessages, "You killed bella!\n") {
+		t.Fatal("the death should be told to both")
+	}
+
+	testCases := []struct {
+		input string
+		reply string
+	}{
+		{input: "examine corpse", reply: "The corpse of bella\nThe corpse of bella lies here.\nIt weighs 0\nIt contains:\n\tan apple\n\ta sword\n"},
+		{input: "get corpse", reply: "You can't take the corpse of bella\n"},
+		{input: "get apple from corpse", reply: "You get an apple from the corpse of bella\n"},
+		{input: "get all from bella", reply: "You get a sword from the corpse of bella\n"},
+		{input: "get all from corpse", reply: "The corpse of bella is empty\n"},
+	}
+	for i, tc := range testCases {
+		runInput(t, w, abel, tc.input)
+		if lastMessage(abelMessages) != tc.reply {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, lastMessage(abelMessages), tc.reply)
+		}
+	}
+}
+
+func TestCorpsesRotAway(t *testing.T) {
+	w := newTestWorld(t, []string{arenaArea}, WithCorpseDecay(2), WithDeathPenalty(0))
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "arena")
+	bella, _ := newTestCharacter(w, "bella", "bella", "arena")
+	giveItem(t, w, bella, "apple")
+	bella.experience = 50
+
+	w.killCharacter(bella, abel)
+	if bella.experience != 50 {
+		t.Fatal("there should be no penalty")
+	}
+
+	w.update(time.Second)
+	if findItem(w.rooms["arena"].items, "corpse") == nil {
+		t.Fatal("the corpse should still be there")
+	}
+	w.update(time.Second)
+	if findItem(w.rooms["arena"].items, "corpse") != nil {
+		t.Fatal("the corpse should have rotted away")
+	}
+	if findItem(w.rooms["arena"].items, "apple") == nil {
+		t.Fatal("the contents should be left in the room")
+	}
+	if lastMessage(abelMessages) != "The corpse of bella rots away\n" {
+		t.Fatalf("Got %q", lastMessage(abelMessages))
+	}
+}
@@ -1,44 +1,58 @@
 package game
 
-type Direction uint8
+type Direction string
 
 const (
-	None  Direction = 0x0
-	North           = 0x1
-	East            = 0x2
-	South           = 0x4
-	West            = 0x8
+	None      Direction = ""
+	North     Direction = "north"
+	Northeast Direction = "northeast"
+	East      Direction = "east"
+	Southeast Direction = "southeast"
+	South     Direction = "south"
+	Southwest Direction = "southwest"
+	West      Direction = "west"
+	Northwest Direction = "northwest"
+	Up        Direction = "up"
+	Down      Direction = "down"
 )
 
+// directions in the order they are listed in
+var directions = []Direction{
+	North, Northeast, East, Southeast, South, Southwest, West, Northwest, Up, Down,
+}
+
+var directionAbbreviations = map[string]Direction{
+	"n":  North,
+	"ne": Northeast,
+	"e":  East,
+	"se": Southeast,
+	"s":  South,
+	"sw": Southwest,
+	"w":  West,
+	"nw": Northwest,
+	"u":  Up,
+	"d":  Down,
+}
+
+// DirectionFromString parses both the full and the abbreviated directions
 func DirectionFromString(dir string) Direction {
-	switch dir {
-	case "west":
-		return West
-	case "east":
-		return East
-	case "north":
-		return North
-	case "south":
-		return South
+	if d, ok := directionAbbreviations[dir]; ok {
+		return d
+	}
+	for _, d := range directions {
+		if string(d) == dir {
+			return d
+		}
 	}
 
 	return None
 }
 
-func DirectionAsStrings(dir Direction) []string {
-	dirs := make([]string, 2)
-	if dir&West != 0 {
-		dirs = append(dirs, "west")
+func directionOrder(dir Direction) int {
+	for i, d := range directions {
+		if d == dir {
+			return i
+		}
 	}
-	if dir&East != 0 {
-		dirs = append(dirs, "east")
-	}
-	if dir&North != 0 {
-		dirs = append(dirs, "north")
-	}
-	if dir&South != 0 {
-		dirs = append(dirs, "south")
-	}
-
-	return dirs
+	return len(directions)
 }
@@ -11,12 +11,15 @@ func TestDirectionParsing(t *testing.T) {
 		{input: "east", expected: East},
 		{input: "south", expected: South},
 		{input: "west", expected: West},
+		{input: "up", expected: Up},
+		{input: "ne", expected: Northeast},
+		{input: "d", expected: Down},
 		{input: "error", expected: None},
 	}
 
 	for _, tc := range testCases {
 		if DirectionFromString(tc.input) != tc.expected {
-			t.Fatalf("%d did not match %s", tc.expected, tc.input)
+			t.Fatalf("%s did not match %s", tc.expected, tc.input)
 		}
 	}
 }
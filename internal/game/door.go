@@ -0,0 +1,201 @@
+package game
+
+import (
+	"fmt"
+)
+
+type DoorState string
+
+const (
+	DoorOpen   DoorState = "open"
+	DoorClosed DoorState = "closed"
+	DoorLocked DoorState = "locked"
+)
+
+var knownDoorStates = map[DoorState]bool{
+	DoorOpen:   true,
+	DoorClosed: true,
+	DoorLocked: true,
+}
+
+type Door struct {
+	state        DoorState
+	defaultState DoorState
+	// key is the id of the key item that locks and unlocks the door
+	key string
+	// pickable tells if the lock can be picked without the key
+	pickable bool
+}
+
+func (d *Door) IsOpen() bool {
+	return d.state == DoorOpen
+}
+
+// linkDoors connects the two sides of every two-way door so that their
+// state can be kept the same
+func (w *World) linkDoors() {
+	for _, room := range w.rooms {
+		for _, exit := range room.exits {
+			if exit.door == nil {
+				continue
+			}
+			destination, ok := w.rooms[exit.to]
+			if !ok {
+				continue
+			}
+			for _, back := range destination.exits {
+				if back.to == room.id && back.door != nil {
+					exit.reverse = back
+					break
+				}
+			}
+		}
+	}
+}
+
+// setDoorState changes the state of the door on both sides of the exit
+func setDoorState(exit *Exit, state DoorState) {
+	exit.door.state = state
+	if exit.reverse != nil {
+		exit.reverse.door.state = state
+	}
+}
+
+// findDoor finds the door by the exit keyword. Plain "door" is enough if
+// there's only one door in the room.
+func (r *Room) findDoor(target string) *Exit {
+	if exit := r.Exit(target); exit != nil {
+		if exit.door == nil {
+			return nil
+		}
+		return exit
+	}
+
+	if target != "" && target != "door" {
+		return nil
+	}
+	var found *Exit
+	for _, exit := range r.exits {
+		if exit.door != nil && !exit.hidden {
+			if found != nil {
+				return nil
+			}
+			found = exit
+		}
+	}
+	return found
+}
+
+type doorChange struct {
+	verb, past string
+	from, to   DoorState
+	needsKey   bool
+	// picksLock changes a pickable lock without the key
+	picksLock bool
+	// refusals tells why the door can't be changed in the other states
+	refusals map[DoorState]string
+}
+
+var (
+	openDoor = doorChange{
+		verb: "open", past: "opened",
+		from: DoorClosed, to: DoorOpen,
+		refusals: map[DoorState]string{
+			DoorOpen:   "It's already open\n",
+			DoorLocked: "It's locked\n",
+		},
+	}
+	closeDoor = doorChange{
+		verb: "close", past: "closed",
+		from: DoorOpen, to: DoorClosed,
+		refusals: map[DoorState]string{
+			DoorClosed: "It's already closed\n",
+			DoorLocked: "It's already closed\n",
+		},
+	}
+	lockDoor = doorChange{
+		verb: "lock", past: "locked",
+		from: DoorClosed, to: DoorLocked,
+		needsKey: true,
+		refusals: map[DoorState]string{
+			DoorOpen:   "You have to close it first\n",
+			DoorLocked: "It's already locked\n",
+		},
+	}
+	unlockDoor = doorChange{
+		verb: "unlock", past: "unlocked",
+		from: DoorLocked, to: DoorClosed,
+		needsKey: true,
+		refusals: map[DoorState]string{
+			DoorOpen:   "It's not locked\n",
+			DoorClosed: "It's not locked\n",
+		},
+	}
+	pickDoor = doorChange{
+		verb: "pick", past: "unlocked",
+		from: DoorLocked, to: DoorClosed,
+		picksLock: true,
+		refusals: map[DoorState]string{
+			DoorOpen:   "It's not locked\n",
+			DoorClosed: "It's not locked\n",
+		},
+	}
+)
+
+// target is what the change is done to, e.g. "the door east"
+func (c doorChange) target(exit *Exit) string {
+	if c.picksLock {
+		return "the lock of the door " + exit.keyword
+	}
+	return "the door " + exit.keyword
+}
+
+func doorCommandAction(change doorChange) CommandAction {
+	return func(command Command, ch *Character) WorldAction {
+		return func(world *World) error {
+			room := world.rooms[ch.Room]
+			exit := room.findDoor(command.contents)
+			if exit == nil {
+				ch.Reply(fmt.Sprintf("What do you want to %s?\n", change.verb))
+				return nil
+			}
+
+			door := exit.door
+			if door.state != change.from {
+				ch.Reply(change.refusals[door.state])
+				return nil
+			}
+			if change.needsKey && !ch.HasKey(door.key) {
+				ch.Reply("You don't have the key\n")
+				return nil
+			}
+			if change.picksLock && !door.pickable {
+				ch.Reply("The lock can't be picked\n")
+				return nil
+			}
+
+			setDoorState(exit, change.to)
+			ch.Reply(fmt.Sprintf("You %s %s\n", change.verb, change.target(exit)))
+			world.BroadcastToOtherCharactersInRoom(
+				ch,
+				fmt.Sprintf("%s %ss %s\n", ch.Name, change.verb, change.target(exit)),
+			)
+			if exit.reverse != nil {
+				world.BroadcastToRoom(
+					exit.to,
+					fmt.Sprintf("The door %s is %s from the other side\n", exit.reverse.keyword, change.past),
+				)
+			}
+
+			return nil
+		}
+	}
+}
+
+var (
+	OpenCommandAction   = doorCommandAction(openDoor)
+	CloseCommandAction  = doorCommandAction(closeDoor)
+	LockCommandAction   = doorCommandAction(lockDoor)
+	UnlockCommandAction = doorCommandAction(unlockDoor)
+	PickCommandAction   = doorCommandAction(pickDoor)
+)
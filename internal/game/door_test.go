@@ -0,0 +1,121 @@
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+const houseArea = `{
+	"name": "house",
+	"items": [
+		{"id": "iron-key", "keywords": ["iron", "key"], "short": "an iron key",
+		 "long": "An iron key lies on the floor.", "weight": 1}
+	],
+	"rooms": [
+		{"id": "hall", "title": "Hall", "description": "The hall", "flags": ["start"], "exits": {
+			"east": {"to": "study", "door": {"state": "closed"}},
+			"down": {"to": "cellar", "door": {"state": "locked", "key": "iron-key"}, "hidden": true}
+		}},
+		{"id": "study", "title": "Study", "description": "The study", "items": ["iron-key"], "exits": {
+			"west": {"to": "hall", "door": {"state": "closed"}}
+		}},
+		{"id": "cellar", "title": "Cellar", "exits": {
+			"up": "hall",
+			"north": {"to": "vault", "door": {"state": "locked", "key": "iron-key", "pickable": true}}
+		}},
+		{"id": "vault", "title": "Vault", "exits": {"south": "cellar"}}
+	]
+}`
+
+func TestDoorsAreMirroredOnBothSides(t *testing.T) {
+	w := newTestWorld(t, []string{houseArea})
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "hall")
+	_, bellaMessages := newTestCharacter(w, "bella", "bella", "study")
+
+	runInput(t, w, abel, "east")
+	if abel.Room != "hall" || !strings.Contains(lastMessage(abelMessages), "The door east is closed") {
+		t.Fatalf("closed door should block the way, got %q", lastMessage(abelMessages))
+	}
+
+	runInput(t, w, abel, "open door")
+	if lastMessage(abelMessages) != "You open the door east\n" {
+		t.Fatalf("Got %q", lastMessage(abelMessages))
+	}
+	if lastMessage(bellaMessages) != "The door west is opened from the other side\n" {
+		t.Fatalf("the other side should be notified, got %q", lastMessage(bellaMessages))
+	}
+	if !w.rooms["study"].Exit("west").door.IsOpen() {
+		t.Fatal("the other side of the door should be open too")
+	}
+	if !strings.Contains(w.DescribeRoom("study"), "west (open door)") {
+		t.Fatalf("Got %q, expected the open door to be described", w.DescribeRoom("study"))
+	}
+
+	// the failed move made abel wait
+	runInput(t, w, abel, "e")
+	w.Step()
+	if abel.Room != "study" {
+		t.Fatal("open door should let the character through")
+	}
+
+	runInput(t, w, abel, "close west")
+	if w.rooms["hall"].Exit("east").door.IsOpen() {
+		t.Fatal("closing should close both sides")
+	}
+}
+
+func TestLockedAndHiddenDoors(t *testing.T) {
+	w := newTestWorld(t, []string{houseArea})
+	abel, messages := newTestCharacter(w, "abel", "abel", "hall")
+
+	if description := w.DescribeRoom("hall"); strings.Contains(description, "down") {
+		t.Fatalf("hidden exit should not be listed: %q", description)
+	}
+
+	testCases := []struct {
+		input string
+		reply string
+	}{
+		{input: "down", reply: "You cannot go that way!\n"},
+		{input: "open down", reply: "It's locked\n"},
+		{input: "unlock down", reply: "You don't have the key\n"},
+		{input: "pick down", reply: "The lock can't be picked\n"},
+		{input: "pick east", reply: "It's not locked\n"},
+		{input: "lock east", reply: "You don't have the key\n"},
+		{input: "open east", reply: "You open the door east\n"},
+		{input: "lock east", reply: "You have to close it first\n"},
+		{input: "open east", reply: "It's already open\n"},
+		{input: "open west", reply: "What do you want to open?\n"},
+		{input: "east", reply: "The study"},
+		{input: "get key", reply: "You get an iron key\n"},
+		{input: "west", reply: "The hall"},
+		{input: "unlock down", reply: "You unlock the door down\n"},
+		{input: "open down", reply: "You open the door down\n"},
+		{input: "down", reply: "You move to down"},
+		{input: "drop key", reply: "You drop an iron key\n"},
+		{input: "pick north", reply: "You pick the lock of the door north\n"},
+		{input: "open north", reply: "You open the door north\n"},
+	}
+	for i, tc := range testCases {
+		runInput(t, w, abel, tc.input)
+		if !strings.Contains(lastMessage(messages), tc.reply) {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, lastMessage(messages), tc.reply)
+		}
+		w.Step()
+	}
+}
+
+func TestAreaResetRestoresDoors(t *testing.T) {
+	w := newTestWorld(t, []string{houseArea})
+	setDoorState(w.rooms["hall"].Exit("east"), DoorOpen)
+	setDoorState(w.rooms["hall"].Exit("down"), DoorOpen)
+
+	w.ResetArea("house")
+
+	if w.rooms["study"].Exit("west").door.state != DoorClosed {
+		t.Fatal("door should be closed after the reset")
+	}
+	if w.rooms["hall"].Exit("down").door.state != DoorLocked {
+		t.Fatal("door should be locked after the reset")
+	}
+}
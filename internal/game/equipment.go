@@ -0,0 +1,217 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+type EquipSlot string
+
+const (
+	Head   EquipSlot = "head"
+	Neck   EquipSlot = "neck"
+	Body   EquipSlot = "body"
+	Arms   EquipSlot = "arms"
+	Hands  EquipSlot = "hands"
+	Legs   EquipSlot = "legs"
+	Feet   EquipSlot = "feet"
+	Weapon EquipSlot = "weapon"
+	Shield EquipSlot = "shield"
+)
+
+// equipSlots are in the order they are listed in the equipment
+var equipSlots = []EquipSlot{Head, Neck, Body, Arms, Hands, Legs, Feet, Weapon, Shield}
+
+func isEquipSlot(slot EquipSlot) bool {
+	for _, s := range equipSlots {
+		if s == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats are the numbers that the equipment and the effects modify
+type Stats struct {
+	MaxHealth int `json:"maxHealth"`
+	Attack    int `json:"attack"`
+	Defense   int `json:"defense"`
+}
+
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		MaxHealth: s.MaxHealth + other.MaxHealth,
+		Attack:    s.Attack + other.Attack,
+		Defense:   s.Defense + other.Defense,
+	}
+}
+
+// Effect modifies the stats of the character for a while, e.g. a blessing
+type Effect struct {
+	name     string
+	stats    Stats
+	timeLeft time.Duration
+}
+
+func NewEffect(name string, stats Stats, duration time.Duration) Effect {
+	return Effect{name: name, stats: stats, timeLeft: duration}
+}
+
+func (c *Character) AddEffect(effect Effect) {
+	c.effects = append(c.effects, effect)
+}
+
+// updateEffects removes the effects which have run out
+func (c *Character) updateEffects(timeStep time.Duration) {
+	var active []Effect
+	for _, effect := range c.effects {
+		effect.timeLeft -= timeStep
+		if effect.timeLeft > 0 {
+			active = append(active, effect)
+		} else {
+			c.Broadcast(fmt.Sprintf("The %s wears off\n", effect.name))
+		}
+	}
+	c.effects = active
+	c.clampHealth()
+}
+
+// Stats are the base stats modified by the equipment and the effects
+func (c *Character) Stats() Stats {
+	stats := c.base
+	for _, item := range c.equipment {
+		stats = stats.Add(item.template.stats)
+	}
+	for _, effect := range c.effects {
+		stats = stats.Add(effect.stats)
+	}
+	return stats
+}
+
+// clampHealth keeps the health within the maximum when the equipment or the
+// effects lowering it are removed
+func (c *Character) clampHealth() {
+	if max := c.Stats().MaxHealth; c.health > max {
+		c.health = max
+	}
+}
+
+// carriedWeight is the weight of the inventory and the equipment
+func (c *Character) carriedWeight() int {
+	weight := totalWeight(c.inventory)
+	for _, item := range c.equipment {
+		weight += item.Weight()
+	}
+	return weight
+}
+
+func (c *Character) equippedItem(query string) (EquipSlot, *Item) {
+	for _, slot := range equipSlots {
+		if item, ok := c.equipment[slot]; ok && item.Matches(query) {
+			return slot, item
+		}
+	}
+	return "", nil
+}
+
+type equipVerb struct {
+	verb, verbs string
+	// wield is for the weapons and wear for everything else
+	wield bool
+}
+
+func equipCommandAction(how equipVerb) CommandAction {
+	return func(command Command, ch *Character) WorldAction {
+		return func(world *World) error {
+			item := findItem(ch.inventory, command.contents)
+			if item == nil {
+				ch.Reply("You don't have that\n")
+				return nil
+			}
+
+			slot := item.template.slot
+			if slot == "" || (slot == Weapon) != how.wield {
+				ch.Reply(fmt.Sprintf("You can't %s %s\n", how.verb, item.Short()))
+				return nil
+			}
+			if equipped, ok := ch.equipment[slot]; ok {
+				ch.Reply(fmt.Sprintf("You already have %s on your %s\n", equipped.Short(), slot))
+				return nil
+			}
+
+			ch.inventory = removeItem(ch.inventory, item)
+			ch.equipment[slot] = item
+			world.characterChanged(ch)
+			ch.Reply(fmt.Sprintf("You %s %s\n", how.verb, item.Short()))
+			world.BroadcastToOtherCharactersInRoom(
+				ch,
+				fmt.Sprintf("%s %s %s\n", ch.Name, how.verbs, item.Short()),
+			)
+
+			return nil
+		}
+	}
+}
+
+var (
+	WearCommandAction  = equipCommandAction(equipVerb{verb: "wear", verbs: "wears"})
+	WieldCommandAction = equipCommandAction(equipVerb{verb: "wield", verbs: "wields", wield: true})
+)
+
+func RemoveCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		slot, item := ch.equippedItem(command.contents)
+		if item == nil {
+			ch.Reply("You are not using that\n")
+			return nil
+		}
+
+		delete(ch.equipment, slot)
+		ch.inventory = append(ch.inventory, item)
+		ch.clampHealth()
+		world.characterChanged(ch)
+		ch.Reply(fmt.Sprintf("You remove %s\n", item.Short()))
+		world.BroadcastToOtherCharactersInRoom(
+			ch,
+			fmt.Sprintf("%s removes %s\n", ch.Name, item.Short()),
+		)
+
+		return nil
+	}
+}
+
+func EquipmentCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		if len(ch.equipment) == 0 {
+			ch.Reply("You are not using anything\n")
+			return nil
+		}
+
+		output := "You are using:\n"
+		for _, slot := range equipSlots {
+			if item, ok := ch.equipment[slot]; ok {
+				output += fmt.Sprintf("\t<%s> %s\n", slot, item.Short())
+			}
+		}
+		ch.Reply(output)
+
+		return nil
+	}
+}
+
+func ScoreCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		stats := ch.Stats()
+		output := fmt.Sprintf("%s\n", ch.Name)
+		output += fmt.Sprintf("Health: %d/%d\n", ch.health, stats.MaxHealth)
+		output += fmt.Sprintf("Attack: %d (base %d)\n", stats.Attack, ch.base.Attack)
+		output += fmt.Sprintf("Defense: %d (base %d)\n", stats.Defense, ch.base.Defense)
+		output += fmt.Sprintf("Experience: %d\n", ch.experience)
+		for _, effect := range ch.effects {
+			output += fmt.Sprintf("Affected by %s\n", effect.name)
+		}
+		ch.Reply(output)
+
+		return nil
+	}
+}
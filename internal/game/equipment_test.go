@@ -0,0 +1,120 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+const armoryArea = `{
+	"name": "armory",
+	"items": [
+		{"id": "helmet", "keywords": ["helmet"], "short": "a helmet", "weight": 3,
+		 "slot": "head", "stats": {"defense": 2}},
+		{"id": "cap", "keywords": ["cap"], "short": "a cap", "weight": 1, "slot": "head"},
+		{"id": "sword", "keywords": ["sword"], "short": "a sword", "weight": 5,
+		 "slot": "weapon", "stats": {"attack": 3}},
+		{"id": "amulet", "keywords": ["amulet"], "short": "an amulet", "weight": 1,
+		 "slot": "neck", "stats": {"maxHealth": 10}},
+		{"id": "bread", "keywords": ["bread"], "short": "a loaf of bread", "weight": 1}
+	],
+	"rooms": [
+		{"id": "armory", "title": "Armory", "flags": ["start"],
+		 "items": ["helmet", "cap", "sword", "amulet", "bread"]}
+	]
+}`
+
+func TestWearingAndWieldingItems(t *testing.T) {
+	w := newTestWorld(t, []string{armoryArea})
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "armory")
+	_, bellaMessages := newTestCharacter(w, "bella", "bella", "armory")
+	for _, item := range []string{"helmet", "cap", "sword", "amulet", "bread"} {
+		runInput(t, w, abel, "get "+item)
+	}
+
+	testCases := []struct {
+		input string
+		reply string
+		other string
+	}{
+		{input: "eq", reply: "You are not using anything\n"},
+		{input: "wear bread", reply: "You can't wear a loaf of bread\n"},
+		{input: "wear sword", reply: "You can't wear a sword\n"},
+		{input: "wield helmet", reply: "You can't wield a helmet\n"},
+		{input: "wear helmet", reply: "You wear a helmet\n", other: "abel wears a helmet\n"},
+		{input: "wear cap", reply: "You already have a helmet on your head\n"},
+		{input: "wield sword", reply: "You wield a sword\n", other: "abel wields a sword\n"},
+		{input: "wear amulet", reply: "You wear an amulet\n", other: "abel wears an amulet\n"},
+		{input: "equipment", reply: "You are using:\n\t<head> a helmet\n\t<neck> an amulet\n\t<weapon> a sword\n"},
+		{input: "score", reply: "abel\nHealth: 30/40\nAttack: 4 (base 1)\nDefense: 2 (base 0)\nExperience: 0\n"},
+		{input: "drop sword", reply: "You don't have that\n"},
+		{input: "remove amulet", reply: "You remove an amulet\n", other: "abel removes an amulet\n"},
+		{input: "remove amulet", reply: "You are not using that\n"},
+		{input: "i", reply: "You are carrying:\n\ta cap\n\ta loaf of bread\n\tan amulet\n"},
+	}
+	for i, tc := range testCases {
+		*bellaMessages = nil
+		runInput(t, w, abel, tc.input)
+		if lastMessage(abelMessages) != tc.reply {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, lastMessage(abelMessages), tc.reply)
+		}
+		if lastMessage(bellaMessages) != tc.other {
+			t.Fatalf("Testcase %d: Got %q, expected %q for others", i, lastMessage(bellaMessages), tc.other)
+		}
+	}
+}
+
+func TestRemovingItemsKeepsHealthWithinMaximum(t *testing.T) {
+	w := newTestWorld(t, []string{armoryArea})
+	abel, _ := newTestCharacter(w, "abel", "abel", "armory")
+	runInput(t, w, abel, "get amulet")
+	runInput(t, w, abel, "wear amulet")
+	abel.health = 40
+
+	runInput(t, w, abel, "remove amulet")
+	if abel.health != 30 {
+		t.Fatalf("Got %d, expected the health to drop to the maximum", abel.health)
+	}
+}
+
+func TestEffectsModifyStatsUntilTheyWearOff(t *testing.T) {
+	w := newTestWorld(t, []string{armoryArea})
+	abel, messages := newTestCharacter(w, "abel", "abel", "armory")
+	abel.AddEffect(NewEffect("blessing", Stats{Attack: 2, Defense: 1}, 2*time.Second))
+
+	if stats := abel.Stats(); stats.Attack != 3 || stats.Defense != 1 {
+		t.Fatalf("Got %+v, expected the blessing to modify the stats", stats)
+	}
+
+	w.UpdateCharacterStates(time.Second)
+	if len(abel.effects) != 1 {
+		t.Fatal("the blessing should still be active")
+	}
+	w.UpdateCharacterStates(time.Second)
+	if stats := abel.Stats(); stats.Attack != 1 || stats.Defense != 0 {
+		t.Fatalf("Got %+v, expected the base stats", stats)
+	}
+	if lastMessage(messages) != "The blessing wears off\n" {
+		t.Fatalf("Got %q", lastMessage(messages))
+	}
+}
+
+func TestEquipmentIsSaved(t *testing.T) {
+	store := NewMemoryCharacterStore()
+	w := newTestWorld(t, []string{armoryArea}, WithCharacterStore(store))
+	abel, _ := newTestCharacter(w, "client", "abel", "armory")
+	runInput(t, w, abel, "get sword")
+	runInput(t, w, abel, "wield sword")
+	w.SaveCharacter(abel)
+	w.RemoveCharacterOnDisconnect(abel)
+
+	account, _, _ := newTestAccount(w, "other")
+	w.enterGame(account, "abel")
+
+	ch := w.GetCharacter("other")
+	if item := ch.equipment[Weapon]; item == nil || item.TemplateId() != "sword" {
+		t.Fatal("the sword should be wielded after the login")
+	}
+	if ch.Stats().Attack != 4 {
+		t.Fatalf("Got %d, expected the sword to modify the attack", ch.Stats().Attack)
+	}
+}
@@ -0,0 +1,113 @@
+package game
+
+// Event is structured data about the game sent to the client next to the
+// text, e.g. for drawing a health bar or a map. It's encoded as JSON and
+// clients which can't show it never see it.
+type Event interface {
+	// EventName is the GMCP name of the event, e.g. "Char.Vitals"
+	EventName() string
+}
+
+// CharVitals is the health of the character
+type CharVitals struct {
+	Health    int `json:"hp"`
+	MaxHealth int `json:"maxhp"`
+}
+
+func (CharVitals) EventName() string { return "Char.Vitals" }
+
+// CharStatus is the rest of the character's state shown by the client
+type CharStatus struct {
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	Experience int    `json:"experience"`
+	// Opponent is who the character is fighting, if anyone
+	Opponent string `json:"opponent,omitempty"`
+}
+
+func (CharStatus) EventName() string { return "Char.Status" }
+
+// RoomInfo describes the room the character is in. The exits lead to the
+// room ids by their keywords and the hidden ones are left out.
+type RoomInfo struct {
+	Id          RoomId            `json:"num"`
+	Name        string            `json:"name"`
+	Area        string            `json:"area"`
+	Exits       map[string]RoomId `json:"exits"`
+	Coordinates *RoomCoordinates  `json:"coords,omitempty"`
+}
+
+func (RoomInfo) EventName() string { return "Room.Info" }
+
+// RoomCoordinates is the location of the room on the map, see Coordinate
+type RoomCoordinates struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func vitalsOf(ch *Character) CharVitals {
+	return CharVitals{Health: ch.health, MaxHealth: ch.Stats().MaxHealth}
+}
+
+func statusOf(ch *Character) CharStatus {
+	status := CharStatus{
+		Name:       ch.Name,
+		State:      string(ch.state.state),
+		Experience: ch.experience,
+	}
+	if ch.opponent != nil {
+		status.Opponent = ch.opponent.Name
+	}
+	return status
+}
+
+func (w *World) roomInfo(id RoomId) RoomInfo {
+	room := w.rooms[id]
+	info := RoomInfo{Id: id, Exits: make(map[string]RoomId)}
+	if room == nil {
+		return info
+	}
+	info.Name = room.title
+	info.Area = room.area
+	for _, exit := range room.exits {
+		if !exit.hidden {
+			info.Exits[exit.keyword] = exit.to
+		}
+	}
+	if room.location != nil {
+		info.Coordinates = &RoomCoordinates{X: room.location.X, Y: room.location.Y}
+	}
+	return info
+}
+
+// characterChanged marks that the vitals, the status or the room of the
+// character may have changed. The events are sent after the actions.
+func (w *World) characterChanged(ch *Character) {
+	if !ch.IsMob() {
+		w.changed[ch.Id] = ch
+	}
+}
+
+// sendChangedEvents sends the vitals, the status and the room of each
+// changed player if they differ from what was last sent
+func (w *World) sendChangedEvents() {
+	for id, ch := range w.changed {
+		delete(w.changed, id)
+		account := w.accounts[ch.Id]
+		if account == nil || account.loggedInCharacter != ch {
+			continue
+		}
+		if vitals := vitalsOf(ch); vitals != account.sentVitals {
+			account.sentVitals = vitals
+			account.sendEvent(vitals)
+		}
+		if status := statusOf(ch); status != account.sentStatus {
+			account.sentStatus = status
+			account.sendEvent(status)
+		}
+		if ch.Room != account.sentRoom {
+			account.sentRoom = ch.Room
+			account.sendEvent(w.roomInfo(ch.Room))
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangedEventsAreSentToThePlayer(t *testing.T) {
+	hall := NewRoom("hall", "A hall", map[string]RoomId{"north": "garden"})
+	hall.title = "Hall"
+	hall.area = "house"
+	hall.flags = []RoomFlag{StartRoom}
+	location := NewCoordinate(0, 0)
+	hall.location = &location
+	garden := NewRoom("garden", "A garden", map[string]RoomId{"south": "hall"})
+	garden.title = "Garden"
+	garden.area = "house"
+	garden.exits = append(garden.exits, &Exit{keyword: "down", to: "hall", hidden: true})
+
+	store := NewMemoryAccountStore()
+	store.SaveAccount(AccountData{Name: "abel", Characters: []string{"Abel"}})
+	w := NewWorld(
+		WithAccountStore(store),
+		WithAreas([]Area{{Name: "house", Rooms: []*Room{hall, garden}}}),
+	)
+
+	connection := &fakeConnection{account: "abel"}
+	w.ClientJoined("client", connection, func(string) {})
+	w.Step()
+	if len(connection.events) != 0 {
+		t.Fatalf("Got %v, expected no events before the character is playing", connection.events)
+	}
+
+	testCases := []struct {
+		input  string
+		change func(ch *Character)
+		want   []Event
+	}{
+		{
+			input: "abel",
+			want: []Event{
+				CharVitals{Health: 30, MaxHealth: 30},
+				CharStatus{Name: "Abel", State: "idle"},
+				RoomInfo{
+					Id: "hall", Name: "Hall", Area: "house",
+					Exits:       map[string]RoomId{"north": "garden"},
+					Coordinates: &RoomCoordinates{X: 0, Y: 0},
+				},
+			},
+		},
+		{input: "north", want: []Event{
+			RoomInfo{Id: "garden", Name: "Garden", Area: "house", Exits: map[string]RoomId{"south": "hall"}},
+		}},
+		{change: func(ch *Character) { ch.health -= 5; w.characterChanged(ch) }, want: []Event{
+			CharVitals{Health: 25, MaxHealth: 30},
+		}},
+		{change: func(ch *Character) { ch.experience += 10; w.characterChanged(ch) }, want: []Event{
+			CharStatus{Name: "Abel", State: "idle", Experience: 10},
+		}},
+		// nothing has changed
+		{want: nil},
+		// only the changed players are looked at
+		{change: func(ch *Character) { ch.health -= 5 }, want: nil},
+	}
+
+	for i, tc := range testCases {
+		connection.events = nil
+		if tc.input != "" {
+			w.PassMessageToClient(tc.input+"\r\n", "client")
+		}
+		if tc.change != nil {
+			tc.change(w.GetCharacter("client"))
+		}
+		w.Step()
+		if !reflect.DeepEqual(connection.events, tc.want) {
+			t.Fatalf("Testcase %d: Got %+v, expected %+v", i, connection.events, tc.want)
+		}
+	}
+}
+
+func TestEventsOfCharactersNotPlayingAreIgnored(t *testing.T) {
+	w := NewWorld()
+	connection := &fakeConnection{}
+	account, _, _ := newTestAccount(w, "client")
+	account.connection = connection
+
+	// the character isn't logged in on the account
+	ch := NewCharacter("client", "abel")
+	w.InsertCharacterOnConnect(ch)
+	w.sendChangedEvents()
+
+	if len(connection.events) != 0 {
+		t.Fatalf("Got %v, expected the event to be ignored", connection.events)
+	}
+}
@@ -0,0 +1,335 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCarryWeight is how much a character can carry
+const maxCarryWeight = 50
+
+type ItemTemplateId string
+
+type ItemFlag string
+
+const (
+	// NoTake items can't be picked up, e.g. fountains and statues
+	NoTake ItemFlag = "notake"
+)
+
+var knownItemFlags = map[ItemFlag]bool{
+	NoTake: true,
+}
+
+// ItemTemplate describes a kind of item. Every item in the world is an
+// instance of a template.
+type ItemTemplate struct {
+	id       ItemTemplateId
+	keywords []string
+	// short description is used in the sentences, e.g. "an iron key"
+	short string
+	// long description is shown when the item lies in a room
+	long   string
+	weight int
+	flags  []ItemFlag
+	// slot is where the item is worn or wielded, empty if it can't be
+	slot EquipSlot
+	// stats modify the stats of the character using the item
+	stats Stats
+}
+
+func (t *ItemTemplate) HasFlag(flag ItemFlag) bool {
+	for _, f := range t.flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+type ItemId int
+
+type Item struct {
+	id       ItemId
+	template *ItemTemplate
+	// contents are the items inside, e.g. in a corpse
+	contents []*Item
+	// decay is the number of ticks until the item rots away, zero if never
+	decay int
+}
+
+func (i *Item) TemplateId() ItemTemplateId {
+	return i.template.id
+}
+
+func (i *Item) Short() string {
+	return i.template.short
+}
+
+func (i *Item) Long() string {
+	return i.template.long
+}
+
+func (i *Item) Weight() int {
+	return i.template.weight
+}
+
+// Matches tells if every word of the query is one of the item's keywords
+func (i *Item) Matches(query string) bool {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return false
+	}
+	for _, word := range words {
+		found := false
+		for _, keyword := range i.template.keywords {
+			if keyword == word {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func findItem(items []*Item, query string) *Item {
+	for _, item := range items {
+		if item.Matches(query) {
+			return item
+		}
+	}
+	return nil
+}
+
+func removeItem(items []*Item, item *Item) []*Item {
+	for i, it := range items {
+		if it.id == item.id {
+			return append(items[:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+func totalWeight(items []*Item) int {
+	weight := 0
+	for _, item := range items {
+		weight += item.Weight()
+	}
+	return weight
+}
+
+// NewItem creates a new instance of the template
+func (w *World) NewItem(id ItemTemplateId) (*Item, error) {
+	template, ok := w.itemTemplates[id]
+	if !ok {
+		return nil, ErrUnknownItemTemplate{id: id}
+	}
+	w.nextItemId++
+	return &Item{id: w.nextItemId, template: template}, nil
+}
+
+type ErrUnknownItemTemplate struct {
+	id ItemTemplateId
+}
+
+func (e ErrUnknownItemTemplate) Error() string {
+	return fmt.Sprintf("unknown item template %s", e.id)
+}
+
+func GetCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		room := world.rooms[ch.Room]
+		query, from := command.contents, ""
+		if i := strings.Index(query, " from "); i >= 0 {
+			query, from = query[:i], query[i+len(" from "):]
+		}
+
+		if query == "" {
+			ch.Reply("What do you want to get?\n")
+			return nil
+		}
+		if from == "" {
+			ch.Reply(world.getItem(ch, findItem(room.items, query), query, &room.items, ""))
+			return nil
+		}
+
+		container := findItem(room.items, from)
+		if container == nil {
+			container = findItem(ch.inventory, from)
+		}
+		if container == nil {
+			ch.Reply(fmt.Sprintf("There's no %s here\n", from))
+			return nil
+		}
+		if query != "all" {
+			ch.Reply(world.getItem(ch, findItem(container.contents, query), query, &container.contents, container.Short()))
+			return nil
+		}
+		if len(container.contents) == 0 {
+			ch.Reply(fmt.Sprintf("%s is empty\n", capitalize(container.Short())))
+			return nil
+		}
+		// everything that was taken is told in one reply
+		var reply strings.Builder
+		for _, item := range append([]*Item{}, container.contents...) {
+			reply.WriteString(world.getItem(ch, item, query, &container.contents, container.Short()))
+		}
+		ch.Reply(reply.String())
+
+		return nil
+	}
+}
+
+// getItem moves the item from the room or a container to the inventory. The
+// line telling what happened is returned for the reply.
+func (w *World) getItem(ch *Character, item *Item, query string, items *[]*Item, container string) string {
+	from := ""
+	if container != "" {
+		from = " from " + container
+	}
+
+	switch {
+	case item == nil:
+		return fmt.Sprintf("There's no %s here\n", query)
+	case item.template.HasFlag(NoTake):
+		return fmt.Sprintf("You can't take %s\n", item.Short())
+	case ch.carriedWeight()+item.Weight() > maxCarryWeight:
+		return fmt.Sprintf("%s is too heavy to carry\n", capitalize(item.Short()))
+	}
+
+	*items = removeItem(*items, item)
+	ch.inventory = append(ch.inventory, item)
+	w.BroadcastToOtherCharactersInRoom(
+		ch,
+		fmt.Sprintf("%s gets %s%s\n", ch.Name, item.Short(), from),
+	)
+	return fmt.Sprintf("You get %s%s\n", item.Short(), from)
+}
+
+func DropCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		item := findItem(ch.inventory, command.contents)
+		if item == nil {
+			ch.Reply("You don't have that\n")
+			return nil
+		}
+
+		room := world.rooms[ch.Room]
+		ch.inventory = removeItem(ch.inventory, item)
+		room.items = append(room.items, item)
+		ch.Reply(fmt.Sprintf("You drop %s\n", item.Short()))
+		world.BroadcastToOtherCharactersInRoom(
+			ch,
+			fmt.Sprintf("%s drops %s\n", ch.Name, item.Short()),
+		)
+
+		return nil
+	}
+}
+
+// parseGive splits "key bella" and "key to bella" to the item and the
+// receiver
+func parseGive(contents string) (item, receiver string) {
+	words := strings.Fields(contents)
+	if len(words) < 2 {
+		return contents, ""
+	}
+	receiver = words[len(words)-1]
+	words = words[:len(words)-1]
+	if len(words) > 1 && words[len(words)-1] == "to" {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " "), receiver
+}
+
+func GiveCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		query, receiverName := parseGive(command.contents)
+		item := findItem(ch.inventory, query)
+		if item == nil {
+			ch.Reply("You don't have that\n")
+			return nil
+		}
+
+		receiver := world.characterInRoomByName(ch, receiverName)
+		switch {
+		case receiverName == "":
+			ch.Reply("Give it to whom?\n")
+		case receiver == nil:
+			ch.Reply(fmt.Sprintf("There's no %s here\n", receiverName))
+		case receiver.carriedWeight()+item.Weight() > maxCarryWeight:
+			ch.Reply(fmt.Sprintf("%s can't carry that much\n", receiver.Name))
+		default:
+			ch.inventory = removeItem(ch.inventory, item)
+			receiver.inventory = append(receiver.inventory, item)
+			ch.Reply(fmt.Sprintf("You give %s to %s\n", item.Short(), receiver.Name))
+			receiver.Broadcast(fmt.Sprintf("%s gives you %s\n", ch.Name, item.Short()))
+			for _, other := range world.OtherCharactersInRoom(ch) {
+				if other.Id != receiver.Id {
+					other.Broadcast(fmt.Sprintf("%s gives %s to %s\n", ch.Name, item.Short(), receiver.Name))
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func InventoryCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		if len(ch.inventory) == 0 {
+			ch.Reply("You are not carrying anything\n")
+			return nil
+		}
+
+		output := "You are carrying:\n"
+		for _, item := range ch.inventory {
+			output += fmt.Sprintf("\t%s\n", item.Short())
+		}
+		ch.Reply(output)
+
+		return nil
+	}
+}
+
+func ExamineCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		item := findItem(ch.inventory, command.contents)
+		if item == nil {
+			_, item = ch.equippedItem(command.contents)
+		}
+		if item == nil {
+			item = findItem(world.rooms[ch.Room].items, command.contents)
+		}
+		if item == nil {
+			ch.Reply("You don't see that here\n")
+			return nil
+		}
+
+		output := fmt.Sprintf("%s\n%s\nIt weighs %d\n", capitalize(item.Short()), item.Long(), item.Weight())
+		if len(item.contents) > 0 {
+			output += "It contains:\n"
+			for _, content := range item.contents {
+				output += fmt.Sprintf("\t%s\n", content.Short())
+			}
+		}
+		if slot := item.template.slot; slot == Weapon {
+			output += "It can be wielded\n"
+		} else if slot != "" {
+			output += fmt.Sprintf("It can be worn on the %s\n", slot)
+		}
+		ch.Reply(output)
+
+		return nil
+	}
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,104 @@
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+const shopArea = `{
+	"name": "shop",
+	"items": [
+		{"id": "apple", "keywords": ["red", "apple"], "short": "a red apple",
+		 "long": "A red apple lies on the counter.", "weight": 1},
+		{"id": "anvil", "keywords": ["anvil"], "short": "an anvil",
+		 "long": "A heavy anvil stands here.", "weight": 100},
+		{"id": "statue", "keywords": ["statue"], "short": "a statue",
+		 "long": "A statue of the shopkeeper watches you.", "flags": ["notake"]}
+	],
+	"rooms": [
+		{"id": "shop", "title": "Shop", "flags": ["start"], "items": ["apple", "anvil", "statue"]}
+	]
+}`
+
+func TestGettingAndDroppingItems(t *testing.T) {
+	w := newTestWorld(t, []string{shopArea})
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "shop")
+	_, bellaMessages := newTestCharacter(w, "bella", "bella", "shop")
+
+	look := w.DescribeRoom("shop")
+	if !strings.Contains(look, "A red apple lies on the counter.") {
+		t.Fatalf("items should be listed in the room: %q", look)
+	}
+
+	testCases := []struct {
+		input string
+		reply string
+		other string
+	}{
+		{input: "get pear", reply: "There's no pear here\n"},
+		{input: "get anvil", reply: "An anvil is too heavy to carry\n"},
+		{input: "get statue", reply: "You can't take a statue\n"},
+		{input: "get red apple", reply: "You get a red apple\n", other: "abel gets a red apple\n"},
+		{input: "i", reply: "You are carrying:\n\ta red apple\n"},
+		{input: "examine apple", reply: "A red apple\nA red apple lies on the counter.\nIt weighs 1\n"},
+		{input: "drop apple", reply: "You drop a red apple\n", other: "abel drops a red apple\n"},
+		{input: "inventory", reply: "You are not carrying anything\n"},
+	}
+	for i, tc := range testCases {
+		*bellaMessages = nil
+		runInput(t, w, abel, tc.input)
+		if lastMessage(abelMessages) != tc.reply {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, lastMessage(abelMessages), tc.reply)
+		}
+		if lastMessage(bellaMessages) != tc.other {
+			t.Fatalf("Testcase %d: Got %q, expected %q for others", i, lastMessage(bellaMessages), tc.other)
+		}
+	}
+
+	if findItem(w.rooms["shop"].items, "apple") == nil {
+		t.Fatal("dropped apple should be in the room")
+	}
+}
+
+func TestGivingItems(t *testing.T) {
+	w := newTestWorld(t, []string{shopArea})
+	abel, abelMessages := newTestCharacter(w, "abel", "abel", "shop")
+	bella, bellaMessages := newTestCharacter(w, "bella", "bella", "shop")
+	_, cecilMessages := newTestCharacter(w, "cecil", "cecil", "shop")
+
+	runInput(t, w, abel, "get apple")
+	runInput(t, w, abel, "give apple to dave")
+	if lastMessage(abelMessages) != "There's no dave here\n" {
+		t.Fatalf("Got %q", lastMessage(abelMessages))
+	}
+
+	runInput(t, w, abel, "give apple to Bella")
+	if lastMessage(abelMessages) != "You give a red apple to bella\n" {
+		t.Fatalf("Got %q", lastMessage(abelMessages))
+	}
+	if lastMessage(bellaMessages) != "abel gives you a red apple\n" {
+		t.Fatalf("Got %q", lastMessage(bellaMessages))
+	}
+	if lastMessage(cecilMessages) != "abel gives a red apple to bella\n" {
+		t.Fatalf("Got %q", lastMessage(cecilMessages))
+	}
+	if len(abel.inventory) != 0 || findItem(bella.inventory, "apple") == nil {
+		t.Fatal("the apple should move to bella")
+	}
+}
+
+func TestInventoryIsSaved(t *testing.T) {
+	store := NewMemoryCharacterStore()
+	w := NewWorld(WithCharacterStore(store))
+	abel, _ := newTestCharacter(w, "client", "abel", "another-room")
+	runInput(t, w, abel, "get pipe")
+	w.SaveCharacter(abel)
+
+	account, _, _ := newTestAccount(w, "other")
+	w.RemoveCharacterOnDisconnect(abel)
+	w.enterGame(account, "abel")
+
+	if ch := w.GetCharacter("other"); findItem(ch.inventory, "pipe") == nil {
+		t.Fatal("the pipe should be restored to the inventory")
+	}
+}
@@ -0,0 +1,350 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxPasswordAttempts = 3
+	minPasswordLength   = 6
+	minNameLength       = 3
+	maxNameLength       = 16
+)
+
+// passwordHashCost is a variable so the tests can use a cheaper cost
+var passwordHashCost = bcrypt.DefaultCost
+
+type loginState int
+
+const (
+	loginAccountName loginState = iota
+	loginPassword
+	loginNewPassword
+	loginConfirmPassword
+	loginSelectCharacter
+	loginPlaying
+	// loginChecking waits for the password to be hashed or compared
+	loginChecking
+)
+
+type ErrInvalidName struct {
+	name string
+}
+
+func (e ErrInvalidName) Error() string {
+	return fmt.Sprintf("invalid name %q", e.name)
+}
+
+// IsValidName tells if the name can be used for an account or a character
+func IsValidName(name string) bool {
+	if len(name) < minNameLength || len(name) > maxNameLength {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// LoginAction runs one step of the login for the account. Every step
+// replies exactly once.
+func LoginAction(account *Account, input string) WorldAction {
+	return func(world *World) error {
+		input = strings.TrimSpace(input)
+
+		switch account.loginState {
+		case loginAccountName:
+			world.loginAccountName(account, input)
+		case loginPassword:
+			world.loginPassword(account, input)
+		case loginNewPassword:
+			world.loginNewPassword(account, input)
+		case loginConfirmPassword:
+			world.loginConfirmPassword(account, input)
+		case loginSelectCharacter:
+			world.loginSelectCharacter(account, input)
+		case loginChecking:
+			account.output("Checking the password, please wait\n")
+		default:
+			account.output("You are already playing\n")
+		}
+
+		return nil
+	}
+}
+
+const accountNamePrompt = "What's your account name?\n > \n"
+
+func (w *World) loginAccountName(account *Account, name string) {
+	if !IsValidName(name) {
+		account.output(fmt.Sprintf(
+			"Names are %d to %d letters long\n%s",
+			minNameLength, maxNameLength, accountNamePrompt,
+		))
+		return
+	}
+
+	data, err := w.accountStore.LoadAccount(name)
+	switch err {
+	case nil:
+		account.data = data
+		account.loginState = loginPassword
+		account.suppressEcho(true)
+		account.output("Password:\n > \n")
+	case ErrAccountNotFound:
+		account.data = AccountData{Name: name}
+		account.loginState = loginNewPassword
+		account.suppressEcho(true)
+		account.output(fmt.Sprintf("Creating a new account %s\nPick a password:\n > \n", name))
+	default:
+		fmt.Printf("Failed to load account %s: %v\n", name, err)
+		account.output("Something went wrong, try again\n" + accountNamePrompt)
+	}
+}
+
+// CheckPassword tells if the password is the account's
+func CheckPassword(data AccountData, password string) bool {
+	return bcrypt.CompareHashAndPassword(data.PasswordHash, []byte(password)) == nil
+}
+
+// loginAuthenticated skips the account name and the password of a client
+// which has been authenticated already. It's run as the client joins.
+func (w *World) loginAuthenticated(account *Account, name string) {
+	data, err := w.accountStore.LoadAccount(name)
+	if err != nil {
+		fmt.Printf("Failed to load the authenticated account %s: %v\n", name, err)
+		account.output("Welcome!\n" + accountNamePrompt)
+		return
+	}
+	account.data = data
+	account.loginState = loginSelectCharacter
+	account.output("Welcome back!\n" + characterPrompt(account.data))
+}
+
+// checkPassword runs the slow bcrypt call off the game loop so that the
+// logins don't stop the world. The account is in the checking state until
+// the result has been handled on the game loop, which finishes the input.
+func (w *World) checkPassword(account *Account, check func() error, handle func(err error)) {
+	account.loginState = loginChecking
+	go func() {
+		err := check()
+		action := func(w *World) error {
+			if w.accounts[account.id] != account {
+				return nil
+			}
+			defer account.inputDone()
+			return accountAction(account, "password", func(w *World) error {
+				handle(err)
+				return nil
+			})(w)
+		}
+		w.enqueue(action)
+	}()
+}
+
+func (w *World) loginPassword(account *Account, password string) {
+	hash := account.data.PasswordHash
+	w.checkPassword(account, func() error {
+		return bcrypt.CompareHashAndPassword(hash, []byte(password))
+	}, func(err error) {
+		w.passwordChecked(account, err == nil)
+	})
+}
+
+func (w *World) passwordChecked(account *Account, ok bool) {
+	if ok {
+		account.suppressEcho(false)
+		account.loginState = loginSelectCharacter
+		account.output("\nWelcome back!\n" + characterPrompt(account.data))
+		return
+	}
+
+	account.loginState = loginPassword
+	account.failedAttempts++
+	if account.failedAttempts >= maxPasswordAttempts {
+		account.kick()
+		account.output("\nToo many failed attempts\n")
+		return
+	}
+	account.output("\nWrong password\nPassword:\n > \n")
+}
+
+func (w *World) loginNewPassword(account *Account, password string) {
+	if len(password) < minPasswordLength {
+		account.output(fmt.Sprintf(
+			"\nPasswords are at least %d characters long\nPick a password:\n > \n",
+			minPasswordLength,
+		))
+		return
+	}
+
+	var hash []byte
+	w.checkPassword(account, func() (err error) {
+		hash, err = bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+		return err
+	}, func(err error) {
+		if err != nil {
+			fmt.Printf("Failed to hash password: %v\n", err)
+			account.loginState = loginNewPassword
+			account.output("\nSomething went wrong, try again\nPick a password:\n > \n")
+			return
+		}
+		account.data.PasswordHash = hash
+		account.loginState = loginConfirmPassword
+		account.output("\nConfirm the password:\n > \n")
+	})
+}
+
+func (w *World) loginConfirmPassword(account *Account, password string) {
+	hash := account.data.PasswordHash
+	w.checkPassword(account, func() error {
+		return bcrypt.CompareHashAndPassword(hash, []byte(password))
+	}, func(err error) {
+		w.confirmPasswordChecked(account, err == nil)
+	})
+}
+
+func (w *World) confirmPasswordChecked(account *Account, ok bool) {
+	if !ok {
+		account.loginState = loginNewPassword
+		account.output("\nPasswords don't match\nPick a password:\n > \n")
+		return
+	}
+
+	// someone might have created the account while the password was typed
+	if _, err := w.accountStore.LoadAccount(account.data.Name); err != ErrAccountNotFound {
+		account.suppressEcho(false)
+		account.loginState = loginAccountName
+		account.output("\nThe account name was just taken\n" + accountNamePrompt)
+		return
+	}
+
+	if err := w.accountStore.SaveAccount(account.data); err != nil {
+		fmt.Printf("Failed to save account %s: %v\n", account.data.Name, err)
+		account.loginState = loginNewPassword
+		account.output("\nSomething went wrong, try again\nPick a password:\n > \n")
+		return
+	}
+
+	account.suppressEcho(false)
+	account.loginState = loginSelectCharacter
+	account.output("\nAccount created!\n" + characterPrompt(account.data))
+}
+
+func characterPrompt(data AccountData) string {
+	if len(data.Characters) == 0 {
+		return "Name your first character:\n > \n"
+	}
+	return fmt.Sprintf(
+		"Your characters: %s\nSelect one or name a new character:\n > \n",
+		strings.Join(data.Characters, ", "),
+	)
+}
+
+func (w *World) loginSelectCharacter(account *Account, name string) {
+	selected := ""
+	for _, c := range account.data.Characters {
+		if strings.EqualFold(c, name) {
+			selected = c
+			break
+		}
+	}
+
+	if selected == "" {
+		if !IsValidName(name) {
+			account.output(fmt.Sprintf(
+				"Names are %d to %d letters long\n%s",
+				minNameLength, maxNameLength, characterPrompt(account.data),
+			))
+			return
+		}
+
+		if _, err := w.characterStore.LoadCharacter(name); err != ErrCharacterNotFound {
+			account.output(fmt.Sprintf("The name %s is taken\n%s", name, characterPrompt(account.data)))
+			return
+		}
+
+		data := account.data
+		data.Characters = append(append([]string{}, data.Characters...), name)
+		if err := w.accountStore.SaveAccount(data); err != nil {
+			fmt.Printf("Failed to save account %s: %v\n", data.Name, err)
+			account.output("Something went wrong, try again\n" + characterPrompt(account.data))
+			return
+		}
+		account.data = data
+		selected = name
+	}
+
+	if w.isPlaying(selected) {
+		account.output(fmt.Sprintf("%s is already playing\n%s", selected, characterPrompt(account.data)))
+		return
+	}
+
+	w.enterGame(account, selected)
+}
+
+func (w *World) isPlaying(name string) bool {
+	return w.playerByName(name) != nil
+}
+
+// enterGame restores the saved character and puts it to the world. A
+// character which fails to load doesn't enter so that its save isn't
+// overwritten.
+func (w *World) enterGame(account *Account, name string) {
+	ch := NewCharacter(account.id, name)
+	data, err := w.characterStore.LoadCharacter(name)
+	switch err {
+	case nil:
+		ch.LoadData(data)
+		if ch.Room == "" && data.Coordinate != nil {
+			ch.Room = w.roomAt(*data.Coordinate)
+		}
+		for _, id := range data.Inventory {
+			item, err := w.NewItem(id)
+			if err != nil {
+				fmt.Printf("Failed to restore an item of %s: %v\n", name, err)
+				continue
+			}
+			ch.inventory = append(ch.inventory, item)
+		}
+		for slot, id := range data.Equipment {
+			item, err := w.NewItem(id)
+			if err != nil {
+				fmt.Printf("Failed to restore an item of %s: %v\n", name, err)
+				continue
+			}
+			ch.equipment[slot] = item
+		}
+	case ErrCharacterNotFound:
+		w.SaveCharacter(ch)
+	default:
+		fmt.Printf("Failed to load character %s: %v\n", name, err)
+		account.output(fmt.Sprintf("%s can't be loaded, please contact the admins\n%s", name, characterPrompt(account.data)))
+		return
+	}
+	if account.data.Admin {
+		ch.commands = NewAdminCommandRegistry()
+	} else {
+		ch.commands = NewInGameCommandRegistry()
+	}
+	ch.Reply = account.output
+	ch.Broadcast = account.output
+	account.loggedInCharacter = ch
+	account.loginState = loginPlaying
+	w.InsertCharacterOnConnect(ch)
+
+	w.BroadcastToOtherCharactersInRoom(
+		ch,
+		fmt.Sprintf("%v joined!\n", ch.Name),
+	)
+
+	// the look is the reply to selecting the character
+	if err := LookCommandAction(Command{"look", ""}, ch)(w); err != nil {
+		fmt.Printf("Failed to look: %v\n", err)
+	}
+}
@@ -0,0 +1,227 @@
+package game
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeConnection struct {
+	echoSuppressed bool
+	kicked         bool
+	account        string
+	events         []Event
+	// done is called when an input has been processed
+	done func()
+}
+
+func (c *fakeConnection) SuppressEcho(suppress bool)      { c.echoSuppressed = suppress }
+func (c *fakeConnection) WindowSize() (width, height int) { return 80, 24 }
+func (c *fakeConnection) TerminalType() string            { return "test" }
+func (c *fakeConnection) Kick()                           { c.kicked = true }
+func (c *fakeConnection) AuthenticatedAccount() string    { return c.account }
+func (c *fakeConnection) SendEvent(event Event)           { c.events = append(c.events, event) }
+func (c *fakeConnection) InputDone() {
+	if c.done != nil {
+		c.done()
+	}
+}
+
+type loginStep struct {
+	input          string
+	reply          string
+	echoSuppressed bool
+}
+
+func newTestAccount(w *World, clientId ClientId) (*Account, *fakeConnection, *[]string) {
+	connection := &fakeConnection{}
+	replies := &[]string{}
+	account := NewAccount(clientId, connection, func(message string) { *replies = append(*replies, message) })
+	w.AddAccount(account)
+	return account, connection, replies
+}
+
+func runLoginSteps(t *testing.T, w *World, account *Account, connection *fakeConnection, replies *[]string, steps []loginStep) {
+	t.Helper()
+	for i, step := range steps {
+		*replies = nil
+		if err := LoginAction(account, step.input+"\r\n")(w); err != nil {
+			t.Fatal(err)
+		}
+		// the password is checked off the game loop which posts the result
+		if account.loginState == loginChecking {
+			if err := (<-w.actions)(w); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(*replies) != 1 {
+			t.Fatalf("Step %d: expected exactly one reply, got %v", i, *replies)
+		}
+		if !strings.Contains((*replies)[0], step.reply) {
+			t.Fatalf("Step %d: Got %q, expected it to contain %q", i, (*replies)[0], step.reply)
+		}
+		if connection.echoSuppressed != step.echoSuppressed {
+			t.Fatalf("Step %d: echo suppressed should be %v", i, step.echoSuppressed)
+		}
+	}
+}
+
+func TestLoginCreatesAccountAndCharacter(t *testing.T) {
+	passwordHashCost = bcrypt.MinCost
+	store := NewMemoryAccountStore()
+	w := NewWorld(WithAccountStore(store))
+	account, connection, replies := newTestAccount(w, "client")
+
+	runLoginSteps(t, w, account, connection, replies, []loginStep{
+		{input: "a!", reply: "Names are", echoSuppressed: false},
+		{input: "Abel", reply: "Creating a new account Abel", echoSuppressed: true},
+		{input: "short", reply: "at least", echoSuppressed: true},
+		{input: "secret", reply: "Confirm the password", echoSuppressed: true},
+		{input: "typo", reply: "don't match", echoSuppressed: true},
+		{input: "secret", reply: "Confirm the password", echoSuppressed: true},
+		{input: "secret", reply: "Name your first character", echoSuppressed: false},
+		{input: "Bella", reply: "You look around", echoSuppressed: false},
+	})
+
+	if ch := w.GetCharacter("client"); ch == nil || ch.Name != "Bella" {
+		t.Fatal("Bella should be playing")
+	}
+
+	data, err := store.LoadAccount("abel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data.PasswordHash) == "secret" {
+		t.Fatal("password should be stored hashed")
+	}
+	if len(data.Characters) != 1 || data.Characters[0] != "Bella" {
+		t.Fatalf("the character should be stored with the account, got %v", data.Characters)
+	}
+}
+
+func TestLoginToExistingAccount(t *testing.T) {
+	passwordHashCost = bcrypt.MinCost
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), passwordHashCost)
+	store := NewMemoryAccountStore()
+	store.SaveAccount(AccountData{Name: "abel", PasswordHash: hash, Characters: []string{"Bella"}})
+	w := NewWorld(WithAccountStore(store))
+	account, connection, replies := newTestAccount(w, "client")
+
+	runLoginSteps(t, w, account, connection, replies, []loginStep{
+		{input: "ABEL", reply: "Password", echoSuppressed: true},
+		{input: "wrong", reply: "Wrong password", echoSuppressed: true},
+		{input: "secret", reply: "Your characters: Bella", echoSuppressed: false},
+		{input: "bella", reply: "You look around", echoSuppressed: false},
+	})
+
+	if ch := w.GetCharacter("client"); ch == nil || ch.Name != "Bella" {
+		t.Fatal("Bella should be playing")
+	}
+
+	// the same character can't play twice
+	other, otherConnection, otherReplies := newTestAccount(w, "other")
+	runLoginSteps(t, w, other, otherConnection, otherReplies, []loginStep{
+		{input: "abel", reply: "Password", echoSuppressed: true},
+		{input: "secret", reply: "Your characters", echoSuppressed: false},
+		{input: "Bella", reply: "Bella is already playing", echoSuppressed: false},
+	})
+}
+
+func TestLoginKicksAfterTooManyFailedAttempts(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	store := NewMemoryAccountStore()
+	store.SaveAccount(AccountData{Name: "abel", PasswordHash: hash})
+	w := NewWorld(WithAccountStore(store))
+	account, connection, replies := newTestAccount(w, "client")
+
+	runLoginSteps(t, w, account, connection, replies, []loginStep{
+		{input: "abel", reply: "Password", echoSuppressed: true},
+		{input: "wrong", reply: "Wrong password", echoSuppressed: true},
+		{input: "wrong", reply: "Wrong password", echoSuppressed: true},
+		{input: "wrong", reply: "Too many failed attempts", echoSuppressed: true},
+	})
+
+	if !connection.kicked {
+		t.Fatal("client should be kicked")
+	}
+}
+
+func TestCharacterIsRestoredOnLogin(t *testing.T) {
+	passwordHashCost = bcrypt.MinCost
+	w := NewWorld()
+	account, connection, replies := newTestAccount(w, "client")
+	runLoginSteps(t, w, account, connection, replies, []loginStep{
+		{input: "abel", reply: "Pick a password", echoSuppressed: true},
+		{input: "secret", reply: "Confirm the password", echoSuppressed: true},
+		{input: "secret", reply: "Name your first character", echoSuppressed: false},
+		{input: "bella", reply: "You look around", echoSuppressed: false},
+	})
+
+	w.MoveCharacterInDirection(w.GetCharacter("client"), "east")
+	if err := DisconnectAction(account)(w); err != nil {
+		t.Fatal(err)
+	}
+
+	account, connection, replies = newTestAccount(w, "client")
+	runLoginSteps(t, w, account, connection, replies, []loginStep{
+		{input: "abel", reply: "Password", echoSuppressed: true},
+		{input: "secret", reply: "Your characters: bella", echoSuppressed: false},
+		{input: "bella", reply: "You look around", echoSuppressed: false},
+	})
+
+	if ch := w.GetCharacter("client"); ch.Room != "another-room" {
+		t.Fatalf("Got %s, expected the saved room", ch.Room)
+	}
+
+	// the name of a saved character can't be taken by another account
+	other, otherConnection, otherReplies := newTestAccount(w, "other")
+	runLoginSteps(t, w, other, otherConnection, otherReplies, []loginStep{
+		{input: "cecil", reply: "Pick a password", echoSuppressed: true},
+		{input: "secret", reply: "Confirm the password", echoSuppressed: true},
+		{input: "secret", reply: "Name your first character", echoSuppressed: false},
+		{input: "bella", reply: "The name bella is taken", echoSuppressed: false},
+	})
+}
+
+func TestAuthenticatedClientSkipsTheAccountAndPassword(t *testing.T) {
+	store := NewMemoryAccountStore()
+	store.SaveAccount(AccountData{Name: "abel", Characters: []string{"Bella"}})
+	w := NewWorld(WithAccountStore(store))
+
+	var welcome string
+	w.ClientJoined("client", &fakeConnection{account: "abel"}, func(message string) { welcome = message })
+	w.Step()
+
+	if !strings.Contains(welcome, "Your characters: Bella") {
+		t.Fatalf("Got %q, expected the character prompt", welcome)
+	}
+	if account := w.GetAccount("client"); account.loginState != loginSelectCharacter {
+		t.Fatal("the account should be logged in")
+	}
+}
+
+func TestInputIsRejectedWhilePasswordIsChecked(t *testing.T) {
+	passwordHashCost = bcrypt.MinCost
+	w := NewWorld()
+	account, connection, replies := newTestAccount(w, "client")
+	runLoginSteps(t, w, account, connection, replies, []loginStep{
+		{input: "abel", reply: "Pick a password", echoSuppressed: true},
+	})
+
+	*replies = nil
+	w.loginNewPassword(account, "secret")
+	if err := LoginAction(account, "again\r\n")(w); err != nil {
+		t.Fatal(err)
+	}
+	if len(*replies) != 1 || !strings.Contains((*replies)[0], "Checking the password") {
+		t.Fatalf("Got %v, expected the input to wait for the check", *replies)
+	}
+
+	if err := (<-w.actions)(w); err != nil {
+		t.Fatal(err)
+	}
+	if account.loginState != loginConfirmPassword {
+		t.Fatal("the account should confirm the password after the check")
+	}
+}
@@ -0,0 +1,193 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+type MobTemplateId string
+
+type MobBehaviour string
+
+const (
+	// Wander moves the mob around its own area
+	Wander MobBehaviour = "wander"
+	// Sentinel keeps the mob in its room even if it would wander
+	Sentinel MobBehaviour = "sentinel"
+	// Aggressive attacks the players on sight
+	Aggressive MobBehaviour = "aggressive"
+	// Wimpy flees when its health runs low
+	Wimpy MobBehaviour = "wimpy"
+)
+
+var knownMobBehaviours = map[MobBehaviour]bool{
+	Wander:     true,
+	Sentinel:   true,
+	Aggressive: true,
+	Wimpy:      true,
+}
+
+const (
+	// wanderChance is the percentage chance of a wandering mob moving on a
+	// tick
+	wanderChance = 20
+	// wimpyHealthPercent is the health under which the wimpy mobs flee
+	wimpyHealthPercent = 25
+)
+
+// MobTemplate describes a kind of non-player character. Every mob in the
+// world is a Character created from a template.
+type MobTemplate struct {
+	id       MobTemplateId
+	name     string
+	keywords []string
+	// long description is shown when the mob is in a room
+	long       string
+	stats      Stats
+	behaviours []MobBehaviour
+	// responses are said back when a player says the keyword
+	responses map[string]string
+	items     []ItemTemplateId
+}
+
+func (t *MobTemplate) HasBehaviour(behaviour MobBehaviour) bool {
+	for _, b := range t.behaviours {
+		if b == behaviour {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Character) IsMob() bool {
+	return c.mob != nil
+}
+
+// MatchesName tells if the character is called by the name. Mobs are also
+// called by their keywords, e.g. "old man".
+func (c *Character) MatchesName(name string) bool {
+	if strings.EqualFold(c.Name, name) {
+		return true
+	}
+	if c.mob == nil {
+		return false
+	}
+	words := strings.Fields(strings.ToLower(name))
+	if len(words) == 0 {
+		return false
+	}
+	for _, word := range words {
+		found := false
+		for _, keyword := range c.mob.keywords {
+			if keyword == word {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// NewMob creates a mob from the template. The mob is not in any room yet.
+func (w *World) NewMob(id MobTemplateId) (*Character, error) {
+	template, ok := w.mobTemplates[id]
+	if !ok {
+		return nil, ErrUnknownMobTemplate{id: id}
+	}
+
+	w.nextMobId++
+	mob := NewCharacter(ClientId(fmt.Sprintf("mob-%d", w.nextMobId)), template.name)
+	mob.mob = template
+	mob.base = template.stats
+	mob.health = template.stats.MaxHealth
+	mob.Reply = func(string) {}
+	mob.Broadcast = func(string) {}
+	for _, itemId := range template.items {
+		item, err := w.NewItem(itemId)
+		if err != nil {
+			return nil, err
+		}
+		mob.inventory = append(mob.inventory, item)
+	}
+	return mob, nil
+}
+
+type ErrUnknownMobTemplate struct {
+	id MobTemplateId
+}
+
+func (e ErrUnknownMobTemplate) Error() string {
+	return fmt.Sprintf("unknown mob template %s", e.id)
+}
+
+// spawnMob puts a new mob from the template to the room
+func (w *World) spawnMob(id MobTemplateId, room *Room) {
+	mob, err := w.NewMob(id)
+	if err != nil {
+		fmt.Printf("Failed to spawn a mob to %s: %v\n", room.id, err)
+		return
+	}
+	mob.Room = room.id
+	mob.home = room.id
+	w.InsertCharacterOnConnect(mob)
+}
+
+// runMobBehaviours is called on every tick from the state of the mob
+func (w *World) runMobBehaviours(mob *Character) {
+	template := mob.mob
+
+	if mob.opponent != nil {
+		if template.HasBehaviour(Wimpy) &&
+			mob.health*100 < mob.Stats().MaxHealth*wimpyHealthPercent {
+			FleeCommandAction(Command{"flee", ""}, mob)(w)
+		}
+		return
+	}
+
+	if template.HasBehaviour(Aggressive) {
+		for _, other := range w.OtherCharactersInRoom(mob) {
+			if !other.IsMob() {
+				KillCommandAction(Command{"kill", other.Name}, mob)(w)
+				return
+			}
+		}
+	}
+
+	if template.HasBehaviour(Wander) && !template.HasBehaviour(Sentinel) &&
+		w.random.Intn(100) < wanderChance {
+		room := w.rooms[mob.Room]
+		var exits []*Exit
+		for _, exit := range room.exits {
+			if exit.IsPassable() && !exit.hidden && w.rooms[exit.to].area == room.area {
+				exits = append(exits, exit)
+			}
+		}
+		if len(exits) > 0 {
+			exit := exits[w.random.Intn(len(exits))]
+			GoCommandAction(Command{"go", exit.keyword}, mob)(w)
+		}
+	}
+}
+
+// respondToSay makes the mobs in the room answer to their keywords
+func (w *World) respondToSay(speaker *Character, message string) {
+	if speaker.IsMob() {
+		return
+	}
+	words := strings.Fields(strings.ToLower(message))
+	for _, mob := range w.OtherCharactersInRoom(speaker) {
+		if !mob.IsMob() {
+			continue
+		}
+		for _, word := range words {
+			word = strings.Trim(word, ".,!?")
+			if response, ok := mob.mob.responses[word]; ok {
+				SayCommandAction(Command{"say", response}, mob)(w)
+				break
+			}
+		}
+	}
+}
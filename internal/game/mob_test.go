@@ -0,0 +1,135 @@
+package game
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const forestArea = `{
+	"name": "forest",
+	"items": [
+		{"id": "fang", "keywords": ["fang"], "short": "a wolf fang", "weight": 1}
+	],
+	"mobs": [
+		{"id": "wolf", "name": "the wolf", "keywords": ["grey", "wolf"],
+		 "long": "A grey wolf growls at you.", "stats": {"maxHealth": 8, "attack": 2},
+		 "behaviours": ["aggressive"], "items": ["fang"]},
+		{"id": "rabbit", "name": "the rabbit", "keywords": ["rabbit"],
+		 "long": "A rabbit hops around.", "stats": {"maxHealth": 8},
+		 "behaviours": ["wander", "wimpy"]},
+		{"id": "hermit", "name": "the hermit", "keywords": ["hermit"],
+		 "long": "A hermit meditates here.", "stats": {"maxHealth": 10},
+		 "behaviours": ["wander", "sentinel"], "responses": {"Hello": "Leave me be."}}
+	],
+	"rooms": [
+		{"id": "clearing", "title": "Clearing", "flags": ["start"],
+		 "exits": {"north": "den", "east": "meadow"}, "mobs": ["hermit"]},
+		{"id": "den", "title": "Den", "exits": {"south": "clearing"}, "mobs": ["wolf"]},
+		{"id": "meadow", "title": "Meadow", "exits": {"west": "clearing"}, "mobs": ["rabbit"]}
+	]
+}`
+
+func mobIn(w *World, room RoomId, name string) *Character {
+	for _, ch := range w.charactersIn(room) {
+		if ch.IsMob() && ch.MatchesName(name) {
+			return ch
+		}
+	}
+	return nil
+}
+
+func TestMobsAreSpawnedAndVisible(t *testing.T) {
+	w := newTestWorld(t, []string{forestArea}, WithRandom(&scriptedRandom{}))
+	abel, messages := newTestCharacter(w, "abel", "abel", "clearing")
+
+	runInput(t, w, abel, "look")
+	if !strings.Contains(lastMessage(messages), "A hermit meditates here.") {
+		t.Fatalf("Got %q, expected the hermit to be visible", lastMessage(messages))
+	}
+
+	runInput(t, w, abel, "say hello, hermit")
+	if lastMessage(messages) != "the hermit said Leave me be.\n" {
+		t.Fatalf("Got %q", lastMessage(messages))
+	}
+
+	runInput(t, w, abel, "kill hermit")
+	if lastMessage(messages) != "You attack the hermit!\n" {
+		t.Fatalf("Got %q", lastMessage(messages))
+	}
+}
+
+func TestMobBehaviours(t *testing.T) {
+	random := &scriptedRandom{}
+	w := newTestWorld(t, []string{forestArea}, WithRandom(random))
+	rabbit := mobIn(w, "meadow", "rabbit")
+	hermit := mobIn(w, "clearing", "hermit")
+
+	// the rabbit wanders west, the hermit is a sentinel
+	random.rolls = []int{0, 0}
+	w.UpdateCharacterStates(time.Second)
+	if rabbit.Room != "clearing" || hermit.Room != "clearing" {
+		t.Fatalf("Got rabbit in %s and hermit in %s", rabbit.Room, hermit.Room)
+	}
+
+	// the wolf attacks on sight
+	abel, messages := newTestCharacter(w, "abel", "abel", "den")
+	random.rolls = []int{99, 99, 99}
+	w.UpdateCharacterStates(time.Second)
+	wolf := mobIn(w, "den", "wolf")
+	if wolf.opponent != abel || abel.opponent != wolf {
+		t.Fatal("the wolf should attack abel")
+	}
+	if !containsMessage(messages, "the wolf attacks you!\n") {
+		t.Fatalf("Got %q", *messages)
+	}
+}
+
+func TestWimpyMobsFlee(t *testing.T) {
+	random := &scriptedRandom{}
+	w := newTestWorld(t, []string{forestArea}, WithRandom(random))
+	rabbit := mobIn(w, "meadow", "rabbit")
+	abel, _ := newTestCharacter(w, "abel", "abel", "meadow")
+	runInput(t, w, abel, "kill rabbit")
+
+	// both miss, the rabbit is still healthy enough to stay
+	random.rolls = []int{99, 99}
+	w.UpdateCharacterStates(time.Second)
+	if rabbit.Room != "meadow" {
+		t.Fatal("the rabbit should still fight")
+	}
+
+	// abel hits the rabbit for 2, it misses and flees
+	rabbit.health = 3
+	random.rolls = []int{0, 1, 99, 0, 0}
+	w.UpdateCharacterStates(time.Second)
+	if rabbit.Room != "clearing" || abel.opponent != nil {
+		t.Fatalf("Got the rabbit in %s, expected it to flee", rabbit.Room)
+	}
+}
+
+func TestKilledMobLeavesCorpse(t *testing.T) {
+	w := newTestWorld(t, []string{forestArea}, WithRandom(&scriptedRandom{}))
+	abel, _ := newTestCharacter(w, "abel", "abel", "den")
+	wolf := mobIn(w, "den", "wolf")
+
+	w.killCharacter(wolf, abel)
+
+	if mobIn(w, "den", "wolf") != nil {
+		t.Fatal("the wolf should be gone")
+	}
+	corpse := findItem(w.rooms["den"].items, "corpse")
+	if corpse == nil || findItem(corpse.contents, "fang") == nil {
+		t.Fatal("the corpse should have the fang")
+	}
+}
+
+func TestMobsAreNotSaved(t *testing.T) {
+	store := NewMemoryCharacterStore()
+	w := newTestWorld(t, []string{forestArea}, WithRandom(&scriptedRandom{}))
+	w.characterStore = store
+	w.SaveAllCharacters()
+	if len(store.characters) != 0 {
+		t.Fatalf("Got %d saved characters, expected none", len(store.characters))
+	}
+}
@@ -0,0 +1,66 @@
+package game
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// actionFailedMessage is all the player is told about a failed command
+const actionFailedMessage = "Something went wrong, please try again\n"
+
+// ErrActionPanicked is the error of an action which panicked
+type ErrActionPanicked struct {
+	value interface{}
+	stack []byte
+}
+
+func (e ErrActionPanicked) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.value, e.stack)
+}
+
+// runAction runs the action and turns a panic into an error so that one bad
+// action doesn't take down the whole world
+func (w *World) runAction(action WorldAction) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = ErrActionPanicked{value: value, stack: debug.Stack()}
+		}
+	}()
+	return action(w)
+}
+
+// actionFailed logs the failure and counts it
+func (w *World) actionFailed(err error, what string) {
+	w.failedActions++
+	fmt.Printf("Action failed (%s): %v\n", what, err)
+}
+
+// FailedActions is the number of actions that have failed since the start
+func (w *World) FailedActions() int {
+	return w.failedActions
+}
+
+// characterAction reports the failure of the action to the character and
+// logs it with the input
+func characterAction(ch *Character, input string, action WorldAction) WorldAction {
+	return func(w *World) error {
+		if err := w.runAction(action); err != nil {
+			w.actionFailed(err, fmt.Sprintf("%s %s: %q", ch.Id, ch.Name, strings.TrimSpace(input)))
+			ch.Reply(actionFailedMessage)
+		}
+		return nil
+	}
+}
+
+// accountAction replies to the account when the action fails. The input is
+// not logged as it may be a password.
+func accountAction(account *Account, what string, action WorldAction) WorldAction {
+	return func(w *World) error {
+		if err := w.runAction(action); err != nil {
+			w.actionFailed(err, fmt.Sprintf("%s %s", account.id, what))
+			account.output(actionFailedMessage)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,98 @@
+package game
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newFailingRegistry() *CommandRegistry {
+	return NewCommandRegistry([]CommandInfo{
+		{
+			command: "boom",
+			parser: func(command, rest string) Command {
+				return Command{"boom", rest}
+			},
+			action: func(command Command, ch *Character) WorldAction {
+				return func(w *World) error {
+					var room *Room
+					room.items = nil
+					return nil
+				}
+			},
+		},
+		{
+			command: "fail",
+			parser: func(command, rest string) Command {
+				return Command{"fail", rest}
+			},
+			action: func(command Command, ch *Character) WorldAction {
+				return func(w *World) error {
+					return errors.New("failed")
+				}
+			},
+		},
+	})
+}
+
+func TestFailingCommandsAreIsolated(t *testing.T) {
+	w := NewWorld()
+	abel, messages := newTestCharacter(w, "abel", "abel", "room")
+	abel.commands = newFailingRegistry()
+	account, _, _ := newTestAccount(w, "abel")
+	account.loggedInCharacter = abel
+	account.loginState = loginPlaying
+
+	for i, input := range []string{"boom", "fail"} {
+		w.PassMessageToClient(input+"\r\n", "abel")
+		w.Step()
+		if lastMessage(messages) != actionFailedMessage {
+			t.Fatalf("Testcase %d: Got %q, expected the generic error", i, lastMessage(messages))
+		}
+		if w.FailedActions() != i+1 {
+			t.Fatalf("Testcase %d: Got %d failed actions", i, w.FailedActions())
+		}
+	}
+
+	abel.commands = NewInGameCommandRegistry()
+	w.PassMessageToClient("say still here\r\n", "abel")
+	w.Step()
+	if lastMessage(messages) != "You said still here\n" {
+		t.Fatalf("Got %q, expected the world to keep running", lastMessage(messages))
+	}
+}
+
+func TestFailingTickIsIsolated(t *testing.T) {
+	w := NewWorld()
+	abel, _ := newTestCharacter(w, "abel", "abel", "room")
+	bella, bellaMessages := newTestCharacter(w, "bella", "bella", "room")
+	abel.state.function = func(*Character, *World, time.Duration) {
+		panic("broken state")
+	}
+	bella.SetState(smoking)
+
+	w.Step()
+
+	if w.FailedActions() != 1 {
+		t.Fatalf("Got %d failed actions, expected the tick to fail", w.FailedActions())
+	}
+	if lastMessage(bellaMessages) != "The pipe puffs\n" {
+		t.Fatal("the other characters should still be updated")
+	}
+}
+
+func TestFailingAccountActionStillReplies(t *testing.T) {
+	w := NewWorld()
+	account, _, replies := newTestAccount(w, "client")
+
+	action := accountAction(account, "login", func(*World) error {
+		panic("broken login")
+	})
+	if err := action(w); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*replies) != 1 || (*replies)[0] != actionFailedMessage {
+		t.Fatalf("Got %q, expected exactly one reply so the client isn't left waiting", *replies)
+	}
+}
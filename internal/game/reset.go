@@ -0,0 +1,174 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type resetKind int
+
+const (
+	// resetSpawn spawns the mob in the room up to the max
+	resetSpawn resetKind = iota
+	// resetPut puts the item in the room up to the max
+	resetPut
+	// resetGive gives the item to every mob of the template in the area
+	// that doesn't have one
+	resetGive
+	// resetDoor sets the state of the door
+	resetDoor
+)
+
+// ResetRule is one step of repopulating an area
+type ResetRule struct {
+	kind  resetKind
+	room  RoomId
+	mob   MobTemplateId
+	item  ItemTemplateId
+	max   int
+	door  string
+	state DoorState
+}
+
+type ErrUnknownArea struct {
+	name string
+}
+
+func (e ErrUnknownArea) Error() string {
+	return fmt.Sprintf("unknown area %s", e.name)
+}
+
+func (w *World) area(name string) *Area {
+	for i := range w.areas {
+		if strings.EqualFold(w.areas[i].Name, name) {
+			return &w.areas[i]
+		}
+	}
+	return nil
+}
+
+// ResetArea puts the doors in the area back to their default state and runs
+// the reset rules of the area
+func (w *World) ResetArea(name string) error {
+	area := w.area(name)
+	if area == nil {
+		return ErrUnknownArea{name: name}
+	}
+
+	for _, room := range area.Rooms {
+		for _, exit := range room.exits {
+			if exit.door != nil {
+				setDoorState(exit, exit.door.defaultState)
+			}
+		}
+	}
+
+	for _, rule := range area.Resets {
+		w.runResetRule(area, rule)
+	}
+	return nil
+}
+
+func (w *World) runResetRule(area *Area, rule ResetRule) {
+	room := w.rooms[rule.room]
+	switch rule.kind {
+	case resetSpawn:
+		for count := w.countMobs(rule.mob, rule.room); count < rule.max; count++ {
+			w.spawnMob(rule.mob, room)
+		}
+	case resetPut:
+		count := 0
+		for _, item := range room.items {
+			if item.TemplateId() == rule.item {
+				count++
+			}
+		}
+		for ; count < rule.max; count++ {
+			item, err := w.NewItem(rule.item)
+			if err != nil {
+				fmt.Printf("Failed to put an item to %s: %v\n", room.id, err)
+				return
+			}
+			room.items = append(room.items, item)
+		}
+	case resetGive:
+		for _, mob := range w.allCharacters() {
+			if !mob.IsMob() || mob.mob.id != rule.mob || w.rooms[mob.home].area != area.Name {
+				continue
+			}
+			if mob.hasItem(rule.item) {
+				continue
+			}
+			item, err := w.NewItem(rule.item)
+			if err != nil {
+				fmt.Printf("Failed to give an item to %s: %v\n", mob.Name, err)
+				return
+			}
+			mob.inventory = append(mob.inventory, item)
+		}
+	case resetDoor:
+		if exit := room.Exit(rule.door); exit != nil && exit.door != nil {
+			setDoorState(exit, rule.state)
+		}
+	}
+}
+
+// countMobs counts the living mobs of the template spawned in the room
+func (w *World) countMobs(id MobTemplateId, home RoomId) int {
+	count := 0
+	for _, ch := range w.characters {
+		if ch.IsMob() && ch.mob.id == id && ch.home == home {
+			count++
+		}
+	}
+	return count
+}
+
+func (w *World) hasPlayersIn(area string) bool {
+	for _, ch := range w.players {
+		if w.rooms[ch.Room].area == area {
+			return true
+		}
+	}
+	return false
+}
+
+// updateResets resets the areas whose timer has run out. The areas which
+// are only reset when empty wait until the players have left.
+func (w *World) updateResets(timeStep time.Duration) {
+	for _, area := range w.areas {
+		if area.ResetInterval <= 0 {
+			continue
+		}
+		w.sinceReset[area.Name] += timeStep
+		if w.sinceReset[area.Name] < area.ResetInterval {
+			continue
+		}
+		if area.ResetOnlyWhenEmpty && w.hasPlayersIn(area.Name) {
+			continue
+		}
+		w.ResetArea(area.Name)
+		w.sinceReset[area.Name] = 0
+	}
+}
+
+func ResetCommandAction(command Command, ch *Character) WorldAction {
+	return func(world *World) error {
+		name := command.contents
+		if name == "" {
+			name = world.rooms[ch.Room].area
+		}
+		area := world.area(name)
+		if area == nil {
+			ch.Reply(fmt.Sprintf("There's no area %s\n", name))
+			return nil
+		}
+
+		world.ResetArea(area.Name)
+		world.sinceReset[area.Name] = 0
+		ch.Reply(fmt.Sprintf("The area %s has been reset\n", area.Name))
+
+		return nil
+	}
+}
@@ -0,0 +1,155 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+// farmArea has the eggs and a closed door to the barn with the cow. The
+// road next to it is in another area.
+func farmArea(resets string) string {
+	return `{
+	"name": "farm",
+	"items": [
+		{"id": "egg", "keywords": ["egg"], "short": "an egg", "weight": 1},
+		{"id": "bell", "keywords": ["bell"], "short": "a bell", "weight": 1}
+	],
+	"mobs": [
+		{"id": "hen", "name": "the hen", "keywords": ["hen"], "stats": {"maxHealth": 2}},
+		{"id": "cow", "name": "the cow", "keywords": ["cow"], "stats": {"maxHealth": 20}}
+	],
+	"rooms": [
+		{"id": "yard", "title": "Yard", "flags": ["start"], "items": ["egg", "egg"],
+		 "exits": {"north": {"to": "barn", "door": {"state": "closed"}}, "east": "road"}},
+		{"id": "barn", "title": "Barn", "mobs": ["cow"],
+		 "exits": {"south": {"to": "yard", "door": {"state": "closed"}}}}
+	],
+	"resets": ` + resets + `
+}`
+}
+
+const roadArea = `{
+	"name": "road",
+	"rooms": [{"id": "road", "title": "Road", "exits": {"west": "yard"}}]
+}`
+
+// advance steps the world a tick at a time for the duration
+func advance(w *World, duration time.Duration) {
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += w.timeStep {
+		w.Step()
+	}
+}
+
+func countItems(items []*Item, id ItemTemplateId) int {
+	count := 0
+	for _, item := range items {
+		if item.TemplateId() == id {
+			count++
+		}
+	}
+	return count
+}
+
+func TestResetRules(t *testing.T) {
+	w := newTestWorld(t, []string{farmArea(`{"rules": [
+		{"spawn": "hen", "room": "yard", "max": 2},
+		{"give": "bell", "mob": "cow"},
+		{"door": "n", "room": "yard", "state": "open"}
+	]}`), roadArea})
+
+	if countItems(w.rooms["yard"].items, "egg") != 2 || w.countMobs("hen", "yard") != 2 {
+		t.Fatal("the yard should have two eggs and two hens")
+	}
+	cow := mobIn(w, "barn", "cow")
+	if cow == nil || !cow.hasItem("bell") {
+		t.Fatal("the cow should have the bell")
+	}
+	if !w.rooms["barn"].Exit("south").door.IsOpen() {
+		t.Fatal("the door rule should open the door on both sides")
+	}
+
+	abel, _ := newTestCharacter(w, "abel", "abel", "yard")
+	runInput(t, w, abel, "get egg")
+	w.killCharacter(mobIn(w, "yard", "hen"), abel)
+	w.killCharacter(cow, abel)
+	runInput(t, w, abel, "close north")
+
+	if err := w.ResetArea("farm"); err != nil {
+		t.Fatal(err)
+	}
+	if countItems(w.rooms["yard"].items, "egg") != 2 || w.countMobs("hen", "yard") != 2 {
+		t.Fatal("the eggs and the hens should be back")
+	}
+	if cow := mobIn(w, "barn", "cow"); cow == nil || !cow.hasItem("bell") {
+		t.Fatal("a new cow with a bell should be spawned")
+	}
+	if !w.rooms["yard"].Exit("north").door.IsOpen() {
+		t.Fatal("the door should be opened again")
+	}
+
+	if err := w.ResetArea("farm"); err != nil {
+		t.Fatal(err)
+	}
+	if countItems(w.rooms["yard"].items, "egg") != 2 || w.countMobs("hen", "yard") != 2 {
+		t.Fatal("the reset should not add more than the max")
+	}
+
+	if err := w.ResetArea("moon"); err == nil {
+		t.Fatal("expected an error for an unknown area")
+	}
+}
+
+func TestAreasAreResetOnTimer(t *testing.T) {
+	w := newTestWorld(t, []string{farmArea(`{"interval": "10m"}`), roadArea})
+	w.rooms["yard"].items = nil
+
+	advance(w, 9*time.Minute)
+	if countItems(w.rooms["yard"].items, "egg") != 0 {
+		t.Fatal("the area should not be reset yet")
+	}
+	advance(w, time.Minute)
+	if countItems(w.rooms["yard"].items, "egg") != 2 {
+		t.Fatal("the area should be reset")
+	}
+}
+
+func TestAreasAreResetWhenEmpty(t *testing.T) {
+	w := newTestWorld(t, []string{farmArea(`{"interval": "1m", "onlyWhenEmpty": true}`), roadArea})
+	w.rooms["yard"].items = nil
+	abel, _ := newTestCharacter(w, "abel", "abel", "yard")
+
+	advance(w, 5*time.Minute)
+	if countItems(w.rooms["yard"].items, "egg") != 0 {
+		t.Fatal("the area should not be reset while abel is there")
+	}
+
+	runInput(t, w, abel, "east")
+	advance(w, w.timeStep)
+	if countItems(w.rooms["yard"].items, "egg") != 2 {
+		t.Fatal("the area should be reset once abel has left")
+	}
+}
+
+func TestResetCommandIsForAdmins(t *testing.T) {
+	w := newTestWorld(t, []string{farmArea(`{}`), roadArea})
+	w.rooms["yard"].items = nil
+	abel, messages := newTestCharacter(w, "abel", "abel", "yard")
+
+	runInput(t, w, abel, "reset farm")
+	if lastMessage(messages) != "What is reset farm?\n" {
+		t.Fatalf("Got %q", lastMessage(messages))
+	}
+
+	abel.commands = NewAdminCommandRegistry()
+	runInput(t, w, abel, "reset moon")
+	if lastMessage(messages) != "There's no area moon\n" {
+		t.Fatalf("Got %q", lastMessage(messages))
+	}
+	runInput(t, w, abel, "reset")
+	if lastMessage(messages) != "The area farm has been reset\n" {
+		t.Fatalf("Got %q", lastMessage(messages))
+	}
+	if countItems(w.rooms["yard"].items, "egg") != 2 {
+		t.Fatal("the area should be reset")
+	}
+}
@@ -1,26 +1,113 @@
 package game
 
+import (
+	"sort"
+	"strings"
+)
+
+type RoomId string
+
+type RoomFlag string
+
+const (
+	// StartRoom is where the new characters enter the world
+	StartRoom RoomFlag = "start"
+	// RespawnRoom is where the characters wake up after dying. It defaults
+	// to the start room.
+	RespawnRoom RoomFlag = "respawn"
+)
+
+var knownRoomFlags = map[RoomFlag]bool{
+	StartRoom:   true,
+	RespawnRoom: true,
+}
+
+// Exit leads from a room to another. The keyword is either a direction or
+// a custom one like "portal" which can be typed as a command.
+type Exit struct {
+	keyword string
+	to      RoomId
+	door    *Door
+	// hidden exits are not listed but can be used by those who know them
+	hidden bool
+	// reverse is the other side of a two-way door
+	reverse *Exit
+}
+
+// IsPassable tells if there's no door or the door is open
+func (e *Exit) IsPassable() bool {
+	return e.door == nil || e.door.IsOpen()
+}
+
 type Room struct {
+	id          RoomId
+	area        string
+	title       string
 	description string
-	location    Coordinate
-	exits       Direction
+	// location is optional and only used for the layout
+	location *Coordinate
+	exits    []*Exit
+	flags    []RoomFlag
+	items    []*Item
+}
+
+func NewRoom(id RoomId, description string, exits map[string]RoomId) *Room {
+	room := &Room{
+		id:          id,
+		description: description,
+	}
+	for keyword, to := range exits {
+		room.exits = append(room.exits, &Exit{keyword: exitKeyword(keyword), to: to})
+	}
+	sortExits(room.exits)
+
+	return room
 }
 
-func (r Room) HasExitInDirection(dir Direction) bool {
-	return r.exits&dir != 0
+// sortExits orders the directions first and the custom exits after them
+func sortExits(exits []*Exit) {
+	sort.Slice(exits, func(i, j int) bool {
+		oi := directionOrder(Direction(exits[i].keyword))
+		oj := directionOrder(Direction(exits[j].keyword))
+		if oi != oj {
+			return oi < oj
+		}
+		return exits[i].keyword < exits[j].keyword
+	})
 }
 
-func NewRoom(description string, location Coordinate, exits Direction) Room {
-	return Room{
-		description: description,
-		location:    location,
-		exits:       exits,
+// Exit finds the exit by its keyword. Directions can be abbreviated.
+func (r *Room) Exit(keyword string) *Exit {
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	if dir := DirectionFromString(keyword); dir != None {
+		keyword = string(dir)
+	}
+
+	for _, exit := range r.exits {
+		if exit.keyword == keyword {
+			return exit
+		}
+	}
+	return nil
+}
+
+func (r *Room) HasExit(keyword string) bool {
+	return r.Exit(keyword) != nil
+}
+
+func (r *Room) ExitKeywords() []string {
+	keywords := make([]string, len(r.exits))
+	for i, exit := range r.exits {
+		keywords[i] = exit.keyword
 	}
+	return keywords
 }
 
-func BasicMap() []Room {
-	return []Room{
-		NewRoom("This is the room", Coordinate{X: 0, Y: 0}, East),
-		NewRoom("This another room", Coordinate{X: 1, Y: 0}, West),
+func (r *Room) HasFlag(flag RoomFlag) bool {
+	for _, f := range r.flags {
+		if f == flag {
+			return true
+		}
 	}
+	return false
 }
@@ -3,35 +3,48 @@ package game
 import "testing"
 
 func TestRoomCreation(t *testing.T) {
-	room := NewRoom("desc", NewCoordinate(0, 0), West)
+	room := NewRoom("room", "desc", map[string]RoomId{"west": "other"})
 
 	if room.description != "desc" {
 		t.Fatal("Description now match")
 	}
 
-	if room.location.X != 0 || room.location.Y != 0 {
-		t.Fatal("location is incorrect")
+	if room.id != "room" {
+		t.Fatal("id is incorrect")
 	}
-	if room.exits != West {
+	if exit := room.Exit("west"); exit == nil || exit.to != "other" {
 		t.Fatal("exits are incorrect")
 	}
 }
 
 func TestRoomMultipleExits(t *testing.T) {
-	room := Room{}
-	room.exits = East | South | North
+	room := NewRoom("room", "desc", map[string]RoomId{
+		"portal": "elsewhere",
+		"south":  "b",
+		"east":   "c",
+		"up":     "d",
+		"north":  "e",
+	})
 
-	if !room.HasExitInDirection(North) {
+	if !room.HasExit("north") {
 		t.Fatal("north exit should exist")
 	}
-	if !room.HasExitInDirection(South) {
-		t.Fatal("south exit should exist")
+	if !room.HasExit("s") {
+		t.Fatal("south exit should exist with abbreviation")
 	}
-	if !room.HasExitInDirection(East) {
-		t.Fatal("east exit should exist")
+	if !room.HasExit("Portal") {
+		t.Fatal("portal exit should exist")
 	}
 
-	if room.HasExitInDirection(West) {
+	if room.HasExit("west") {
 		t.Fatal("west exit should NOT exist")
 	}
+
+	want := []string{"north", "east", "south", "up", "portal"}
+	keywords := room.ExitKeywords()
+	for i := range want {
+		if keywords[i] != want[i] {
+			t.Fatalf("Got %v, expected directions in order and custom exits last: %v", keywords, want)
+		}
+	}
 }
@@ -0,0 +1,57 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+// newTestWorld creates a world of the areas given as JSON, one file each
+func newTestWorld(t *testing.T, areas []string, options ...WorldOption) *World {
+	t.Helper()
+	files := fstest.MapFS{}
+	for i, area := range areas {
+		files[fmt.Sprintf("area%d.json", i)] = &fstest.MapFile{Data: []byte(area)}
+	}
+	loaded, err := LoadAreas(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWorld(append([]WorldOption{WithAreas(loaded)}, options...)...)
+}
+
+// newTestCharacter puts a character to the room. Everything it's told,
+// including the broadcasts, is collected to the messages.
+func newTestCharacter(w *World, id ClientId, name string, room RoomId) (*Character, *[]string) {
+	messages := &[]string{}
+	ch := NewCharacter(id, name)
+	ch.commands = NewInGameCommandRegistry()
+	ch.Room = room
+	ch.Reply = func(message string) { *messages = append(*messages, message) }
+	ch.Broadcast = ch.Reply
+	w.InsertCharacterOnConnect(ch)
+	return ch, messages
+}
+
+func runInput(t *testing.T, w *World, ch *Character, input string) {
+	t.Helper()
+	if err := ch.commands.InputToAction(input, ch)(w); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lastMessage(messages *[]string) string {
+	if len(*messages) == 0 {
+		return ""
+	}
+	return (*messages)[len(*messages)-1]
+}
+
+func containsMessage(messages *[]string, message string) bool {
+	for _, m := range *messages {
+		if m == message {
+			return true
+		}
+	}
+	return false
+}
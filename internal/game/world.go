@@ -2,170 +2,430 @@ package game
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
+// Worlder is how the clients talk to the world. The calls only send a
+// message to the game loop, the world itself is changed by the game loop
+// goroutine alone.
 type Worlder interface {
 	ClientJoined(
 		clientId ClientId,
-		directReply func(message string),
-		reply func(message string),
-		broadcast func(message string),
+		connection Connection,
+		output func(message string),
 	)
-	ClientDisconnected(ClientId) error
-	PassMessageToClient(string, ClientId)
+	// ClientDisconnected and PassMessageToClient return false if the world
+	// has stopped and won't tell the connection that the input is done
+	ClientDisconnected(ClientId) bool
+	PassMessageToClient(string, ClientId) bool
+	Announce(message string)
+	// Do runs the function on the game loop and waits for it
+	Do(f func(w *World))
 }
 
 type World struct {
-	accounts   []*Account
-	characters map[Coordinate][]*Character
-	rooms      map[Coordinate]Room
-	timeStep   time.Duration
-	actions    chan WorldAction
+	accountStore     AccountStore
+	characterStore   CharacterStore
+	autosaveInterval time.Duration
+	sinceAutosave    time.Duration
+	accounts         map[ClientId]*Account
+	characters       map[ClientId]*Character
+	players          map[string]*Character              // the players by lowercase name
+	occupants        map[RoomId]map[ClientId]*Character // the characters in each room
+	changed          map[ClientId]*Character            // the players whose events are to be sent
+	rooms            map[RoomId]*Room
+	areas            []Area
+	itemTemplates    map[ItemTemplateId]*ItemTemplate
+	nextItemId       ItemId
+	mobTemplates     map[MobTemplateId]*MobTemplate
+	nextMobId        int
+	// sinceReset is the time since the area was reset by its name
+	sinceReset       map[string]time.Duration
+	startRoom        RoomId
+	respawnRoom      RoomId
+	corpseDecayTicks int
+	deathPenalty     int
+	random           Random
+	clock            Clock
+	timeStep         time.Duration
+	actions          chan WorldAction
+	stop             chan struct{}
+	stopped          chan struct{}
+	failedActions    int
 }
 
 func (w *World) GetAccount(clientId ClientId) *Account {
-	for _, a := range w.accounts {
-		if a.id == clientId {
-			return a
-		}
+	return w.accounts[clientId]
+}
+
+// The defaults of the world, also used as the defaults of the server's config
+const (
+	DefaultAutosaveInterval = time.Minute
+	DefaultTimeStep         = time.Second
+)
+
+// actionBufferSize lets the actions be queued without the game loop running,
+// e.g. before calling Step in the tests
+const actionBufferSize = 64
+
+type WorldOption func(*World)
+
+func WithAccountStore(store AccountStore) WorldOption {
+	return func(w *World) {
+		w.accountStore = store
+	}
+}
+
+func WithCharacterStore(store CharacterStore) WorldOption {
+	return func(w *World) {
+		w.characterStore = store
+	}
+}
+
+// WithAutosaveInterval sets how often the characters in the world are saved
+func WithAutosaveInterval(interval time.Duration) WorldOption {
+	return func(w *World) {
+		w.autosaveInterval = interval
+	}
+}
+
+// WithAreas sets the areas of the world instead of the default ones
+func WithAreas(areas []Area) WorldOption {
+	return func(w *World) {
+		w.areas = areas
+	}
+}
+
+// WithTimeStep sets how often the world is updated
+func WithTimeStep(timeStep time.Duration) WorldOption {
+	return func(w *World) {
+		w.timeStep = timeStep
 	}
-	return nil
 }
 
-func NewWorld() *World {
+func NewWorld(options ...WorldOption) *World {
 	world := &World{
-		characters: make(map[Coordinate][]*Character),
-		rooms:      make(map[Coordinate]Room),
-		timeStep:   time.Second,
-		actions:    make(chan WorldAction),
-		accounts:   make([]*Account, 0),
+		accountStore:     NewMemoryAccountStore(),
+		characterStore:   NewMemoryCharacterStore(),
+		autosaveInterval: DefaultAutosaveInterval,
+		characters:       make(map[ClientId]*Character),
+		players:          make(map[string]*Character),
+		occupants:        make(map[RoomId]map[ClientId]*Character),
+		changed:          make(map[ClientId]*Character),
+		rooms:            make(map[RoomId]*Room),
+		itemTemplates:    make(map[ItemTemplateId]*ItemTemplate),
+		mobTemplates:     make(map[MobTemplateId]*MobTemplate),
+		sinceReset:       make(map[string]time.Duration),
+		clock:            realClock{},
+		timeStep:         DefaultTimeStep,
+		actions:          make(chan WorldAction, actionBufferSize),
+		stop:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+		accounts:         make(map[ClientId]*Account),
+		random:           newDefaultRandom(),
+		corpseDecayTicks: defaultCorpseDecayTicks,
+		deathPenalty:     defaultDeathPenalty,
 	}
 
-	for _, room := range BasicMap() {
-		world.rooms[room.location] = room
+	for _, option := range options {
+		option(world)
+	}
+
+	if world.areas == nil {
+		world.areas = DefaultAreas()
+	}
+	for _, area := range world.areas {
+		for _, template := range area.Items {
+			world.itemTemplates[template.id] = template
+		}
+		for _, template := range area.Mobs {
+			world.mobTemplates[template.id] = template
+		}
+	}
+	for _, area := range world.areas {
+		for _, room := range area.Rooms {
+			world.rooms[room.id] = room
+			if room.HasFlag(StartRoom) {
+				world.startRoom = room.id
+			}
+			if room.HasFlag(RespawnRoom) {
+				world.respawnRoom = room.id
+			}
+		}
+	}
+	if world.respawnRoom == "" {
+		world.respawnRoom = world.startRoom
+	}
+	world.linkDoors()
+	for _, area := range world.areas {
+		world.ResetArea(area.Name)
 	}
 
 	return world
 }
 
+// ClientJoined queues the creation of the client's account. The client is
+// welcomed once the account has been added by the game loop.
 func (w *World) ClientJoined(
 	clientId ClientId,
-	directReply func(messasage string),
-	reply func(message string),
-	broadcast func(message string),
+	connection Connection,
+	output func(message string),
 ) {
-	account := NewAccount(clientId, directReply, reply, broadcast)
-	w.accounts = append(w.accounts, account)
-	account.directReply("What's the character?\n > \n")
-}
-
-func (world *World) ClientDisconnected(clientId ClientId) error {
-	account := world.GetAccount(clientId)
-	if ch := account.loggedInCharacter; ch != nil {
-		if ch := world.GetCharacter(ClientId(clientId)); ch != nil {
-			world.RemoveCharacterOnDisconnect(ch)
-			world.BroadcastToOtherCharactersInRoom(
-				ch,
-				fmt.Sprintf("%v disconnecting...\n", ch.Name),
-			)
-		} else {
-			return ErrUnknownCharacter{id: clientId, action: "disconnecting"}
+	w.enqueue(func(w *World) error {
+		account := NewAccount(clientId, connection, output)
+		w.AddAccount(account)
+		if name := account.authenticatedAccount(); name != "" {
+			w.loginAuthenticated(account, name)
+			return nil
 		}
-	}
-
-	for i, acc := range world.accounts {
-		if acc.id == clientId {
-			world.accounts[i] = world.accounts[len(world.accounts)-1]
-			world.accounts = world.accounts[:len(world.accounts)-1]
+		account.output("Welcome!\n" + accountNamePrompt)
+		return nil
+	})
+}
 
-			break
+// ClientDisconnected queues the removal of the client's account and
+// character. The connection is told once the removal has been processed by
+// the game loop.
+func (w *World) ClientDisconnected(clientId ClientId) bool {
+	return w.enqueue(func(w *World) error {
+		account := w.GetAccount(clientId)
+		if account == nil {
+			return ErrUnknownClientId{id: clientId}
 		}
-	}
+		defer account.inputDone()
+		return accountAction(account, "disconnect", DisconnectAction(account))(w)
+	})
+}
 
-	return nil
+func (w *World) AddAccount(account *Account) {
+	w.accounts[account.id] = account
 }
 
-func (world *World) handleAccountMessage(account *Account, msg string) {
-	ch := NewCharacter(ClientId(account.id), msg)
-	ch.commands = NewInGameCommandRegistry()
-	ch.Reply = account.reply
-	ch.Broadcast = account.broadcast
-	ch.SetState("idle")
-	account.loggedInCharacter = ch
-	world.InsertCharacterOnConnect(ch)
+func (w *World) RemoveAccount(clientId ClientId) {
+	delete(w.accounts, clientId)
+}
 
-	world.BroadcastToOtherCharactersInRoom(
-		ch,
-		fmt.Sprintf("%v joined!\n", ch.Name),
-	)
+// PassMessageToClient queues the input of the client. The game loop runs it
+// as a command of the logged in character or as a step of the login and
+// then tells the connection that the input is done.
+func (w *World) PassMessageToClient(msg string, clientId ClientId) bool {
+	return w.enqueue(func(w *World) error {
+		account := w.GetAccount(clientId)
+		if account == nil {
+			return ErrUnknownClientId{id: clientId}
+		}
+		if ch := account.loggedInCharacter; ch != nil {
+			defer account.inputDone()
+			return ch.commands.InputToAction(msg, ch)(w)
+		}
 
-	action := ch.commands.InputToAction("look", account.loggedInCharacter)
-	world.actions <- action
+		checking := account.loginState == loginChecking
+		err := accountAction(account, "login", LoginAction(account, msg))(w)
+		// an input which starts a password check is done when the result is handled
+		if checking || account.loginState != loginChecking {
+			account.inputDone()
+		}
+		return err
+	})
 }
 
-func (w *World) handleCharacterMessasge(ch *Character, msg string) {
-	action := ch.commands.InputToAction(msg, ch)
-	w.actions <- action
+// LoadAccount reads the stored account on the game loop, e.g. for checking
+// the credentials of a client before it joins
+func (w *World) LoadAccount(name string) (data AccountData, err error) {
+	w.Do(func(w *World) {
+		data, err = w.accountStore.LoadAccount(name)
+	})
+	return data, err
 }
 
-func (world *World) PassMessageToClient(msg string, clientId ClientId) {
-	if account := world.GetAccount(clientId); account != nil {
-		if account.loggedInCharacter != nil {
-			world.handleCharacterMessasge(account.loggedInCharacter, msg)
-		} else {
-			world.handleAccountMessage(account, msg)
-		}
+// Do runs the function on the game loop and waits for it to finish. It lets
+// the world be inspected safely while the game loop is running. Nothing is
+// run once the world has been stopped.
+func (w *World) Do(f func(w *World)) {
+	done := make(chan struct{})
+	queued := w.enqueue(func(w *World) error {
+		defer close(done)
+		f(w)
+		return nil
+	})
+	if !queued {
+		return
+	}
+	select {
+	case <-done:
+	case <-w.stopped:
 	}
 }
 
+// Announce sends the message to everyone connected to the world.
+func (w *World) Announce(message string) {
+	w.enqueue(AnnounceAction(message))
+}
+
+// enqueue sends the action to the game loop. The action is dropped if the
+// world is stopped so that the caller isn't blocked forever.
+func (w *World) enqueue(action WorldAction) bool {
+	// the buffer may have room after the stop too
+	select {
+	case <-w.stop:
+		return false
+	default:
+	}
+	select {
+	case w.actions <- action:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
+// RunGameLoop runs the actions as soon as they arrive and updates the world
+// on every tick
 func (w *World) RunGameLoop() {
-	ticker := time.NewTicker(w.timeStep)
+	ticker := w.clock.NewTicker(w.timeStep)
 	defer ticker.Stop()
 
-	var actions []WorldAction
 	for {
 		select {
-		case command, ok := <-w.actions:
+		case action, ok := <-w.actions:
 			if !ok {
 				panic("actions channel closed")
 			}
-			actions = append(actions, command)
-		case _, ok := <-ticker.C:
-			if !ok {
-				panic("ticker closed")
-			}
+			w.runActions([]WorldAction{action})
+		case <-ticker.C():
+			w.Step()
+		case <-w.stop:
+			w.runActions(w.pendingActions())
+			w.SaveAllCharacters()
+			close(w.stopped)
+			return
+		}
+	}
+}
 
-			for _, action := range actions {
-				err := action(w)
-				if err != nil {
-					panic(err)
-				}
-			}
+// Step runs the actions waiting in the channel and updates the world by
+// exactly one tick. The game loop calls it on every tick and the tests can
+// call it directly instead of running the loop.
+func (w *World) Step() {
+	w.runActions(w.pendingActions())
+	w.update(w.timeStep)
+	w.sendChangedEvents()
+}
+
+// Stop stops the game loop once the already queued actions have been run
+// and the characters saved. It blocks until the game loop has returned.
+func (w *World) Stop() {
+	close(w.stop)
+	<-w.stopped
+}
+
+func (w *World) update(timeStep time.Duration) {
+	w.runTimedCommands()
+	w.UpdateCharacterStates(timeStep)
+	w.UpdateItems()
+	w.updateResets(timeStep)
 
-			w.UpdateCharacterStates(w.timeStep)
-			actions = make([]WorldAction, 0)
+	w.sinceAutosave += timeStep
+	if w.autosaveInterval > 0 && w.sinceAutosave >= w.autosaveInterval {
+		w.SaveAllCharacters()
+		w.sinceAutosave = 0
+	}
+}
+
+func (w *World) SaveCharacter(ch *Character) {
+	if err := w.characterStore.SaveCharacter(ch.Data()); err != nil {
+		fmt.Printf("Failed to save character %s: %v\n", ch.Name, err)
+	}
+}
+
+func (w *World) SaveAllCharacters() {
+	for _, ch := range w.players {
+		w.SaveCharacter(ch)
+	}
+}
+
+func (w *World) pendingActions() []WorldAction {
+	var actions []WorldAction
+	for {
+		select {
+		case action := <-w.actions:
+			actions = append(actions, action)
+		default:
+			return actions
+		}
+	}
+}
+
+func (w *World) runActions(actions []WorldAction) {
+	for _, action := range actions {
+		if err := w.runAction(action); err != nil {
+			w.actionFailed(err, "action")
 		}
 	}
+	w.sendChangedEvents()
 }
 
+// InsertCharacterOnConnect puts the character to its room. Characters
+// without a room are put to the start room.
 func (w *World) InsertCharacterOnConnect(character *Character) {
-	loc := character.Coordinate
+	if _, ok := w.rooms[character.Room]; !ok {
+		character.Room = w.startRoom
+	}
+	w.characters[character.Id] = character
+	if !character.IsMob() {
+		w.players[strings.ToLower(character.Name)] = character
+	}
+	w.enterRoom(character, character.Room)
+}
+
+// RemoveCharacterOnDisconnect removes the character from the world
+func (w *World) RemoveCharacterOnDisconnect(ch *Character) {
+	w.leaveRoom(ch)
+	delete(w.characters, ch.Id)
+	if w.players[strings.ToLower(ch.Name)] == ch {
+		delete(w.players, strings.ToLower(ch.Name))
+	}
+}
 
-	list, ok := w.characters[loc]
+func (w *World) enterRoom(ch *Character, room RoomId) {
+	occupants, ok := w.occupants[room]
 	if !ok {
-		w.characters[loc] = []*Character{character}
-	} else {
-		list = append(list, character)
-		w.characters[loc] = list
+		occupants = make(map[ClientId]*Character)
+		w.occupants[room] = occupants
 	}
+	occupants[ch.Id] = ch
+	ch.Room = room
+	w.characterChanged(ch)
 }
 
-func (w *World) OtherCharactersInRoom(currentCharacter *Character) []*Character {
-	inRoom := w.characters[currentCharacter.Coordinate]
+func (w *World) leaveRoom(ch *Character) {
+	occupants := w.occupants[ch.Room]
+	delete(occupants, ch.Id)
+	if len(occupants) == 0 {
+		delete(w.occupants, ch.Room)
+	}
+}
+
+// charactersIn returns the characters in the room sorted by their id
+func (w *World) charactersIn(room RoomId) []*Character {
+	occupants := w.occupants[room]
+	chs := make([]*Character, 0, len(occupants))
+	for _, ch := range occupants {
+		chs = append(chs, ch)
+	}
+	sortById(chs)
+	return chs
+}
+
+func sortById(chs []*Character) {
+	sort.Slice(chs, func(i, j int) bool { return chs[i].Id < chs[j].Id })
+}
 
+func (w *World) OtherCharactersInRoom(currentCharacter *Character) []*Character {
 	var others []*Character
-	for _, ch := range inRoom {
+	for _, ch := range w.charactersIn(currentCharacter.Room) {
 		if ch.Id != currentCharacter.Id {
 			others = append(others, ch)
 		}
@@ -174,92 +434,128 @@ func (w *World) OtherCharactersInRoom(currentCharacter *Character) []*Character
 }
 
 func (w *World) BroadcastToOtherCharactersInRoom(currentCh *Character, message string) {
-	inRoom := w.characters[currentCh.Coordinate]
+	for _, ch := range w.OtherCharactersInRoom(currentCh) {
+		ch.Broadcast(message)
+	}
+}
 
-	for _, ch := range inRoom {
-		if ch.Id != currentCh.Id {
-			ch.Broadcast(message)
-		}
+func (w *World) BroadcastToRoom(room RoomId, message string) {
+	for _, ch := range w.charactersIn(room) {
+		ch.Broadcast(message)
 	}
 }
 
-func (w World) GetCharacter(id ClientId) *Character {
-	for _, chs := range w.characters {
-		for _, ch := range chs {
-			if ch.Id == id {
-				return ch
-			}
+func (w *World) characterInRoomByName(currentCh *Character, name string) *Character {
+	for _, ch := range w.OtherCharactersInRoom(currentCh) {
+		if ch.MatchesName(name) {
+			return ch
 		}
 	}
 	return nil
 }
 
-func (w *World) RemoveCharacterOnDisconnect(ch *Character) {
-	// remove the disconnecting ch from the room
-	chs := w.characters[ch.Coordinate]
-	for i, c := range chs {
-		if c.Id == ch.Id {
-			chs[i] = chs[(len(chs) - 1)]
-			chs = chs[:len(chs)-1]
-			break
-		}
-	}
-	w.characters[ch.Coordinate] = chs
+func (w *World) GetCharacter(id ClientId) *Character {
+	return w.characters[id]
+}
+
+// playerByName finds the character of a player by its name in any case
+func (w *World) playerByName(name string) *Character {
+	return w.players[strings.ToLower(name)]
 }
 
-func (w World) CanCharactorMoveInDirection(character *Character, direction Direction) bool {
-	return w.rooms[character.Coordinate].exits&direction != 0
+func (w World) CanCharactorMoveInDirection(character *Character, exit string) bool {
+	e := w.rooms[character.Room].Exit(exit)
+	return e != nil && e.IsPassable()
 }
 
-func (w World) MoveCharacterInDirection(character *Character, direction Direction) {
-	old := NewCoordinate(character.Coordinate.X, character.Coordinate.Y)
-	new := CoordinateInDirection(old, direction)
+// MoveCharacterInDirection moves the character through the exit. The exit
+// must exist, check it first with CanCharactorMoveInDirection.
+func (w World) MoveCharacterInDirection(character *Character, exit string) {
+	w.MoveCharacterToRoom(character, w.rooms[character.Room].Exit(exit).to)
+}
 
-	// add to new location
-	list, ok := w.characters[new]
-	if !ok {
-		w.characters[new] = []*Character{character}
-	} else {
-		list = append(list, character)
-		w.characters[new] = list
-	}
-	character.Coordinate = new
-
-	// remove character from old
-	list, ok = w.characters[old]
-	if ok {
-		ic := -1
-		for i, c := range list {
-			if character.Name == c.Name {
-				ic = i
-				break
-			}
-		}
+func (w World) MoveCharacterToRoom(character *Character, new RoomId) {
+	w.leaveRoom(character)
+	w.enterRoom(character, new)
+}
 
-		if ic > -1 {
-			newLen := len(list) - 1
-			list[ic] = list[newLen]
-			if newLen > 0 {
-				w.characters[old] = list[:newLen]
-			} else {
-				delete(w.characters, old)
-			}
+// allCharacters returns the characters in the same order every tick which
+// keeps the fights deterministic
+func (w *World) allCharacters() []*Character {
+	allChs := make([]*Character, 0, len(w.characters))
+	for _, ch := range w.characters {
+		allChs = append(allChs, ch)
+	}
+	sortById(allChs)
+	return allChs
+}
+
+// runTimedCommands counts down the waits and runs the next queued command of
+// the characters whose wait is over
+func (w *World) runTimedCommands() {
+	for _, ch := range w.allCharacters() {
+		if ch.wait > 0 {
+			ch.wait--
 		}
+		if ch.wait > 0 || len(ch.queue) == 0 {
+			continue
+		}
+		next := ch.queue[0]
+		ch.queue = ch.queue[1:]
+		ch.wait = next.lag
+		w.runActions([]WorldAction{next.action})
 	}
 }
 
-func (w World) UpdateCharacterStates(timeStep time.Duration) {
-	var allChs []*Character
-	for _, c := range w.characters {
-		allChs = append(allChs, c...)
+func (w *World) UpdateCharacterStates(timeStep time.Duration) {
+	for _, ch := range w.allCharacters() {
+		tick := func(w *World) error {
+			ch.Tick(timeStep, w)
+			return nil
+		}
+		if err := w.runAction(tick); err != nil {
+			w.actionFailed(err, fmt.Sprintf("tick of %s %s", ch.Id, ch.Name))
+		}
 	}
+}
 
-	for _, ch := range allChs {
-		ch.Tick(timeStep, w)
+// roomAt finds the room by its coordinate, or returns the start room if
+// there's no room at the coordinate
+func (w World) roomAt(location Coordinate) RoomId {
+	for id, room := range w.rooms {
+		if room.location != nil && *room.location == location {
+			return id
+		}
 	}
+	return w.startRoom
 }
 
-func (w World) DescribeRoom(location Coordinate) string {
-	room := w.rooms[location]
-	return fmt.Sprintf("%s\n%s\n", room.description, DirectionAsStrings(room.exits))
+func (w World) DescribeRoom(id RoomId) string {
+	room := w.rooms[id]
+	var exits []string
+	for _, exit := range room.exits {
+		if exit.hidden {
+			continue
+		}
+		if exit.door == nil {
+			exits = append(exits, exit.keyword)
+		} else if exit.door.IsOpen() {
+			exits = append(exits, fmt.Sprintf("%s (open door)", exit.keyword))
+		} else {
+			exits = append(exits, fmt.Sprintf("%s (closed door)", exit.keyword))
+		}
+	}
+	if len(exits) == 0 {
+		exits = []string{"none"}
+	}
+	description := fmt.Sprintf("%s\n%s\nExits: %s\n", room.title, room.description, strings.Join(exits, ", "))
+	for _, item := range room.items {
+		description += item.Long() + "\n"
+	}
+	for _, ch := range w.charactersIn(id) {
+		if ch.IsMob() {
+			description += ch.mob.long + "\n"
+		}
+	}
+	return description
 }
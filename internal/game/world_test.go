@@ -1,7 +1,13 @@
 package game
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestBasicWorldFunctionality(t *testing.T) {
@@ -21,12 +27,12 @@ func TestBasicWorldFunctionality(t *testing.T) {
 		t.Fatal("Bella should be in the same room")
 	}
 
-	w.MoveCharacterInDirection(w.GetCharacter(clientId2), East)
+	w.MoveCharacterInDirection(w.GetCharacter(clientId2), "east")
 	if o := w.OtherCharactersInRoom(ch); len(o) > 0 {
 		t.Fatal("There should not be other characters in the room")
 	}
 
-	if w.GetCharacter(clientId).Coordinate == w.GetCharacter(clientId2).Coordinate {
+	if w.GetCharacter(clientId).Room == w.GetCharacter(clientId2).Room {
 		t.Fatal("after movement characters are not in the same location")
 	}
 
@@ -40,3 +46,305 @@ func TestBasicWorldFunctionality(t *testing.T) {
 		t.Fatalf("Character not removed. id: %s", clientId2)
 	}
 }
+
+func TestDisconnectRemovesAccountAndCharacter(t *testing.T) {
+	w := NewWorld()
+	var clientId ClientId = "clientId"
+	var clientId2 ClientId = "clientId2"
+
+	var replies []string
+	account := NewAccount(clientId, nil, func(message string) { replies = append(replies, message) })
+	w.AddAccount(account)
+	ch := NewCharacter(clientId, "abel")
+	account.loggedInCharacter = ch
+	w.InsertCharacterOnConnect(ch)
+
+	var broadcasts []string
+	other := NewCharacter(clientId2, "bella")
+	other.Broadcast = func(message string) { broadcasts = append(broadcasts, message) }
+	w.InsertCharacterOnConnect(other)
+
+	if err := DisconnectAction(account)(w); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.GetCharacter(clientId) != nil {
+		t.Fatal("character should be removed")
+	}
+	if w.GetAccount(clientId) != nil {
+		t.Fatal("account should be removed")
+	}
+	if len(replies) != 1 {
+		t.Fatalf("account should get exactly one reply, got %v", replies)
+	}
+	if len(broadcasts) != 1 || broadcasts[0] != "abel disconnected\n" {
+		t.Fatalf("others in the room should be notified, got %v", broadcasts)
+	}
+}
+
+func TestStopRunsPendingActions(t *testing.T) {
+	w := NewWorld()
+	go w.RunGameLoop()
+
+	ran := false
+	w.actions <- func(w *World) error {
+		ran = true
+		return nil
+	}
+	w.Stop()
+
+	if !ran {
+		t.Fatal("pending action should be run before stopping")
+	}
+}
+
+func TestCallsDontBlockAfterStop(t *testing.T) {
+	w := NewWorld()
+	go w.RunGameLoop()
+	w.Stop()
+
+	returned := make(chan struct{})
+	go func() {
+		// more than fits in the channel
+		for i := 0; i < 2*cap(w.actions); i++ {
+			w.Announce("hello\n")
+		}
+		w.PassMessageToClient("look\r\n", "client")
+		w.ClientDisconnected("client")
+		w.Do(func(w *World) {})
+		close(returned)
+	}()
+
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the calls should return once the world is stopped")
+	}
+}
+
+func TestAutosave(t *testing.T) {
+	store := NewMemoryCharacterStore()
+	w := NewWorld(WithCharacterStore(store), WithAutosaveInterval(2*time.Second))
+	w.InsertCharacterOnConnect(NewCharacter("clientId", "abel"))
+
+	w.update(time.Second)
+	if _, err := store.LoadCharacter("abel"); err != ErrCharacterNotFound {
+		t.Fatal("character should not be saved before the interval")
+	}
+
+	w.update(time.Second)
+	if _, err := store.LoadCharacter("abel"); err != nil {
+		t.Fatalf("character should be saved after the interval: %v", err)
+	}
+}
+
+func TestMovingThroughCustomExits(t *testing.T) {
+	hall := NewRoom("hall", "A hall", map[string]RoomId{"portal": "tower", "u": "attic"})
+	hall.flags = []RoomFlag{StartRoom}
+	tower := NewRoom("tower", "A tower far away", map[string]RoomId{"enter portal": "hall"})
+	attic := NewRoom("attic", "An attic", map[string]RoomId{"down": "hall"})
+	w := NewWorld(WithAreas([]Area{{Name: "test", Rooms: []*Room{hall, tower, attic}}}))
+
+	var replies []string
+	ch := NewCharacter("clientId", "abel")
+	ch.commands = NewInGameCommandRegistry()
+	ch.Reply = func(message string) { replies = append(replies, message) }
+	w.InsertCharacterOnConnect(ch)
+
+	testCases := []struct {
+		input string
+		room  RoomId
+	}{
+		{input: "portal", room: "tower"},
+		{input: "north", room: "tower"},
+		{input: "enter portal", room: "hall"},
+		{input: "u", room: "attic"},
+		{input: "go down", room: "hall"},
+	}
+
+	for i, tc := range testCases {
+		if err := ch.commands.InputToAction(tc.input, ch)(w); err != nil {
+			t.Fatal(err)
+		}
+		if ch.Room != tc.room {
+			t.Fatalf("Testcase %d: Got %s, expected %s. Replies %v", i, ch.Room, tc.room, replies)
+		}
+		if len(w.occupants[tc.room]) != 1 {
+			t.Fatalf("Testcase %d: the character should be in the room index", i)
+		}
+		w.Step()
+	}
+}
+
+// simulatedClient talks to the world like the server's client does: the
+// replies are collected until the world tells that the input is done
+type simulatedClient struct {
+	id ClientId
+	w  *World
+	// the replies of a timed command may still come after done is signaled
+	mutex   sync.Mutex
+	replies []string
+	done    chan struct{}
+}
+
+func joinSimulatedClient(w *World, id ClientId) *simulatedClient {
+	c := &simulatedClient{id: id, w: w, done: make(chan struct{}, 1)}
+	connection := &fakeConnection{done: func() { c.done <- struct{}{} }}
+	w.ClientJoined(id, connection, func(message string) {
+		c.mutex.Lock()
+		c.replies = append(c.replies, message)
+		c.mutex.Unlock()
+	})
+	return c
+}
+
+func (c *simulatedClient) send(input string) string {
+	c.mutex.Lock()
+	c.replies = nil
+	c.mutex.Unlock()
+	c.w.PassMessageToClient(input+"\r\n", c.id)
+	<-c.done
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return strings.Join(c.replies, "")
+}
+
+func (c *simulatedClient) disconnect() {
+	c.w.ClientDisconnected(c.id)
+	<-c.done
+}
+
+func TestConcurrentClients(t *testing.T) {
+	passwordHashCost = bcrypt.MinCost
+	w := NewWorld()
+	go w.RunGameLoop()
+	defer w.Stop()
+
+	const clients = 50
+	var wg sync.WaitGroup
+	failures := make(chan string, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := joinSimulatedClient(w, ClientId(fmt.Sprintf("client%d", i)))
+			name := fmt.Sprintf("abel%c%c", 'a'+i/26, 'a'+i%26)
+			steps := []struct{ input, reply string }{
+				{name, "Pick a password"},
+				{"secret", "Confirm the password"},
+				{"secret", "Name your first character"},
+				{name, "You look around"},
+				{"say hello", "You said hello"},
+				{"east", ""},
+				{"look", "You look around"},
+				{"west", ""},
+				{"score", "Health"},
+			}
+			for _, step := range steps {
+				if reply := c.send(step.input); !strings.Contains(reply, step.reply) {
+					failures <- fmt.Sprintf("%s: %q got %q", name, step.input, reply)
+					break
+				}
+			}
+			c.disconnect()
+		}(i)
+	}
+	wg.Wait()
+	close(failures)
+
+	for failure := range failures {
+		t.Error(failure)
+	}
+	w.Do(func(w *World) {
+		if len(w.accounts) != 0 {
+			t.Errorf("Got %d accounts, expected all to be removed", len(w.accounts))
+		}
+		for _, ch := range w.allCharacters() {
+			if !ch.IsMob() {
+				t.Errorf("%s should be removed", ch.Name)
+			}
+		}
+	})
+}
+
+func TestIndexesFollowTheCharacter(t *testing.T) {
+	w := NewWorld()
+	ch := NewCharacter("clientId", "Abel")
+	w.InsertCharacterOnConnect(ch)
+
+	if w.GetCharacter("clientId") != ch || w.playerByName("ABEL") != ch {
+		t.Fatal("the character should be found by its id and name")
+	}
+	if !w.isInRoom(ch, "room") {
+		t.Fatal("the character should be in the start room")
+	}
+
+	w.MoveCharacterInDirection(ch, "east")
+	if w.isInRoom(ch, "room") || !w.isInRoom(ch, "another-room") {
+		t.Fatal("the character should only be in the room it moved to")
+	}
+	if _, ok := w.occupants["room"]; ok {
+		t.Fatal("empty rooms should not be kept in the index")
+	}
+
+	w.RemoveCharacterOnDisconnect(ch)
+	if w.GetCharacter("clientId") != nil || w.playerByName("abel") != nil || w.isInRoom(ch, "another-room") {
+		t.Fatal("the character should be removed from every index")
+	}
+}
+
+const crowd = 500
+
+// newCrowdedWorld has a logged in player for every id
+func newCrowdedWorld() (*World, []ClientId) {
+	w := NewWorld()
+	ids := make([]ClientId, crowd)
+	for i := range ids {
+		id := ClientId(fmt.Sprintf("client%d", i))
+		ids[i] = id
+		account := NewAccount(id, nil, func(string) {})
+		w.AddAccount(account)
+		ch := NewCharacter(id, fmt.Sprintf("player%d", i))
+		account.loggedInCharacter = ch
+		w.InsertCharacterOnConnect(ch)
+	}
+	return w, ids
+}
+
+func BenchmarkGetCharacter(b *testing.B) {
+	w, ids := newCrowdedWorld()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.GetCharacter(ids[i%crowd])
+	}
+}
+
+func BenchmarkGetAccount(b *testing.B) {
+	w, ids := newCrowdedWorld()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.GetAccount(ids[i%crowd])
+	}
+}
+
+func BenchmarkMoveCharacter(b *testing.B) {
+	w, ids := newCrowdedWorld()
+	ch := w.GetCharacter(ids[crowd/2])
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%2 == 0 {
+			w.MoveCharacterInDirection(ch, "east")
+		} else {
+			w.MoveCharacterInDirection(ch, "west")
+		}
+	}
+}
+
+func BenchmarkIsPlaying(b *testing.B) {
+	w, _ := newCrowdedWorld()
+	name := fmt.Sprintf("player%d", crowd-1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.isPlaying(name)
+	}
+}
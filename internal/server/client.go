@@ -2,8 +2,12 @@ package server
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mkauppila/mud/internal/game"
@@ -20,110 +24,182 @@ func UuidGenerator() (ClientId, error) {
 	return ClientId(id.String()), nil
 }
 
+// Terminal is the protocol spoken with the client. Read returns the input
+// with the protocol's own data stripped.
+type Terminal interface {
+	io.Reader
+	// Negotiate is called once before the client joins the world
+	Negotiate() error
+	SuppressEcho(suppress bool)
+	WindowSize() (width, height int)
+	TerminalType() string
+	// SendEvent sends the structured data if the protocol has a way for it
+	SendEvent(event game.Event)
+}
+
 type Client struct {
-	id        ClientId
-	conn      net.Conn
-	broadcast chan string
-	reply     chan string
+	id           ClientId
+	conn         net.Conn
+	terminal     Terminal
+	output       *OutputQueue
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+	// account is set when the client has been authenticated already
+	account string
+	// written is closed once the output has been written
+	written chan struct{}
+	// processed gets a value when the world has processed an input
+	processed chan struct{}
+	done      chan struct{}
+	kicked    int32
 
 	world game.Worlder
 }
 
-func NewClient(conn net.Conn, id ClientId, world game.Worlder) *Client {
+// NewClient creates a client speaking telnet
+func NewClient(conn net.Conn, id ClientId, world game.Worlder, options OutputOptions) *Client {
+	client := newClient(conn, id, world, options)
+	client.terminal = NewTelnet(conn, queueWriter{client.output})
+	return client
+}
+
+func newClient(conn net.Conn, id ClientId, world game.Worlder, options OutputOptions) *Client {
 	client := &Client{
-		id:        id,
-		conn:      conn,
-		broadcast: make(chan string),
-		reply:     make(chan string),
+		id:           id,
+		conn:         conn,
+		writeTimeout: options.WriteTimeout,
+		written:      make(chan struct{}),
+		// only one input is processed at a time so the game loop never
+		// waits for Listen to take the signal
+		processed: make(chan struct{}, 1),
+		done:      make(chan struct{}),
 		world:     world,
 	}
+	client.output = NewOutputQueue(options.QueueSize, options.Policy, func() {
+		fmt.Printf("Client %s is too slow, disconnecting\n", id)
+		// the queue is filled by the game loop, which mustn't wait for the
+		// close, e.g. an SSH or a TLS close may be stuck on the slow client
+		go client.Close()
+	})
 
 	return client
 }
 
 func (c *Client) Listen() {
-	reader := bufio.NewReader(c.conn)
+	if err := c.terminal.Negotiate(); err != nil {
+		fmt.Println("Failed to negotiate the terminal options")
+	}
+	reader := bufio.NewReader(c.terminal)
 
 	c.world.ClientJoined(
 		game.ClientId(c.id),
-		func(message string) {
-			c.directReply(message)
-		},
-		func(message string) {
-			c.reply <- message
-		},
-		func(message string) {
-			c.broadcast <- message
-		},
+		c,
+		c.output.Push,
 	)
 
 	for {
+		if c.idleTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		}
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			// disconnect command tells the server to clean up this client
-			// the break here breaks the Listen loop
-			// actions <- c.registry.DisconnectAction(c.id)
-			<-c.reply
+			// tell the world to clean up this client and wait for it to
+			// finish, after that nothing is sent to the client
+			if c.world.ClientDisconnected(game.ClientId(c.id)) {
+				<-c.processed
+			}
 			break
 		}
 
-		c.world.PassMessageToClient(line, game.ClientId(c.id))
+		// the replies are queued by the world, the next input is read
+		// once this one has been processed
+		if c.world.PassMessageToClient(line, game.ClientId(c.id)) {
+			<-c.processed
+		}
 
-		// Wait for client's reply
-		commandReply, ok := <-c.reply
-		if !ok {
-			break
+		if atomic.LoadInt32(&c.kicked) != 0 {
+			// the next read fails and runs the disconnect
+			c.output.Close()
+			<-c.written
+			c.Close()
 		}
-		c.directReply(commandReply)
 	}
 
 	fmt.Printf("Client %s disconnected (listen)\n", c.id)
 }
 
-func (c *Client) directReply(message string) {
-	writer := bufio.NewWriter(c.conn)
-
-	_, err := writer.WriteString(message)
-	if err != nil {
-		fmt.Println("Failed to write")
-	}
-
-	err = writer.Flush()
-	if err != nil {
-		fmt.Println("Failed to flush")
-	}
-}
+// WriteOutput writes the queued output to the connection until the queue is
+// closed. A write which doesn't finish in time closes the connection.
+func (c *Client) WriteOutput() {
+	defer close(c.written)
 
-func (c *Client) Broadcast() {
-	writer := bufio.NewWriter(c.conn)
 	for {
-		message, ok := <-c.broadcast
+		message, ok := c.output.Pop()
 		if !ok {
 			break
 		}
 
-		_, err := writer.WriteString(message)
-		if err != nil {
-			fmt.Println("Failed to write")
+		if c.writeTimeout > 0 {
+			c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
 		}
-
-		err = writer.Flush()
-		if err != nil {
-			fmt.Println("Failed to flush")
+		// every message is written at once so that it isn't split
+		if _, err := io.WriteString(c.conn, message); err != nil {
+			fmt.Printf("Failed to write to %s: %v\n", c.id, err)
+			c.Close()
+			break
 		}
 	}
 
 	fmt.Printf("Client %s disconnected (server)\n", c.id)
 }
 
-func (c *Client) Disconnect() {
-	fmt.Printf("Disconnecting %s\n", c.id)
+// QueueDepth is the number of messages waiting to be written to the client
+func (c *Client) QueueDepth() int {
+	return c.output.Len()
+}
+
+func (c *Client) SuppressEcho(suppress bool) {
+	c.terminal.SuppressEcho(suppress)
+}
+
+func (c *Client) WindowSize() (width, height int) {
+	return c.terminal.WindowSize()
+}
 
-	close(c.broadcast)
-	close(c.reply)
+func (c *Client) TerminalType() string {
+	return c.terminal.TerminalType()
+}
+
+func (c *Client) SendEvent(event game.Event) {
+	c.terminal.SendEvent(event)
+}
+
+func (c *Client) InputDone() {
+	c.processed <- struct{}{}
+}
 
+func (c *Client) AuthenticatedAccount() string {
+	return c.account
+}
+
+// Kick disconnects the client after the next reply is written
+func (c *Client) Kick() {
+	atomic.StoreInt32(&c.kicked, 1)
+}
+
+// Close closes the connection which makes Listen run the disconnect.
+func (c *Client) Close() {
 	err := c.conn.Close()
-	if err != nil {
-		panic(err)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		fmt.Printf("Failed to close %s: %v\n", c.id, err)
 	}
 }
+
+func (c *Client) Disconnect() {
+	fmt.Printf("Disconnecting %s\n", c.id)
+
+	c.output.Close()
+	c.Close()
+	<-c.written
+	close(c.done)
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SlowClientPolicy decides what happens when a client's output queue is full
+type SlowClientPolicy int
+
+const (
+	// DropOldest drops the oldest queued message to make room for the new one
+	DropOldest SlowClientPolicy = iota
+	// Coalesce appends the new message to the last queued one
+	Coalesce
+	// DisconnectSlow drops the queued output and disconnects the client
+	DisconnectSlow
+)
+
+func (p SlowClientPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case Coalesce:
+		return "coalesce"
+	case DisconnectSlow:
+		return "disconnect"
+	}
+	return fmt.Sprintf("SlowClientPolicy(%d)", int(p))
+}
+
+type ErrUnknownPolicy struct {
+	name string
+}
+
+func (e ErrUnknownPolicy) Error() string {
+	return fmt.Sprintf("unknown slow client policy %q", e.name)
+}
+
+// ParseSlowClientPolicy parses the policy from its name
+func ParseSlowClientPolicy(name string) (SlowClientPolicy, error) {
+	for _, policy := range []SlowClientPolicy{DropOldest, Coalesce, DisconnectSlow} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+	return DropOldest, ErrUnknownPolicy{name: name}
+}
+
+const (
+	defaultOutputQueueSize = 256
+	defaultWriteTimeout    = 10 * time.Second
+)
+
+// OutputOptions configures the output of every client
+type OutputOptions struct {
+	QueueSize    int
+	Policy       SlowClientPolicy
+	WriteTimeout time.Duration
+}
+
+func DefaultOutputOptions() OutputOptions {
+	return OutputOptions{
+		QueueSize:    defaultOutputQueueSize,
+		Policy:       DropOldest,
+		WriteTimeout: defaultWriteTimeout,
+	}
+}
+
+// OutputQueue is a bounded queue of the messages waiting to be written to
+// the client. Push never blocks so the game loop can't be stalled by a slow
+// client.
+type OutputQueue struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	messages []string
+	size     int
+	policy   SlowClientPolicy
+	closed   bool
+	// overflow is called when the client is disconnected for being slow
+	overflow func()
+}
+
+func NewOutputQueue(size int, policy SlowClientPolicy, overflow func()) *OutputQueue {
+	if size < 1 {
+		size = 1
+	}
+	q := &OutputQueue{
+		size:     size,
+		policy:   policy,
+		overflow: overflow,
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+// Push queues the message. Messages pushed after Close are dropped.
+func (q *OutputQueue) Push(message string) {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return
+	}
+
+	if len(q.messages) >= q.size {
+		switch q.policy {
+		case Coalesce:
+			q.messages[len(q.messages)-1] += message
+			q.mutex.Unlock()
+			return
+		case DisconnectSlow:
+			q.messages = nil
+			q.closed = true
+			q.cond.Broadcast()
+			q.mutex.Unlock()
+			if q.overflow != nil {
+				q.overflow()
+			}
+			return
+		default:
+			q.messages = q.messages[1:]
+		}
+	}
+
+	q.messages = append(q.messages, message)
+	q.cond.Signal()
+	q.mutex.Unlock()
+}
+
+// Pop waits for the next message. It returns false once the queue has been
+// closed and emptied.
+func (q *OutputQueue) Pop() (string, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.messages) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.messages) == 0 {
+		return "", false
+	}
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+	return message, true
+}
+
+// Close stops accepting new messages. The ones already queued can still
+// be popped.
+func (q *OutputQueue) Close() {
+	q.mutex.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+// Len is the number of messages waiting to be written
+func (q *OutputQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.messages)
+}
+
+// queueWriter lets the telnet negotiation be written through the queue
+type queueWriter struct {
+	queue *OutputQueue
+}
+
+func (w queueWriter) Write(p []byte) (int, error) {
+	w.queue.Push(string(p))
+	return len(p), nil
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkauppila/mud/internal/game"
+)
+
+func popAll(q *OutputQueue) []string {
+	q.Close()
+	var messages []string
+	for {
+		message, ok := q.Pop()
+		if !ok {
+			return messages
+		}
+		messages = append(messages, message)
+	}
+}
+
+func TestOutputQueuePolicies(t *testing.T) {
+	testCases := []struct {
+		policy       SlowClientPolicy
+		want         string
+		disconnected bool
+	}{
+		{policy: DropOldest, want: "b c d"},
+		{policy: Coalesce, want: "a b cd"},
+		{policy: DisconnectSlow, want: "", disconnected: true},
+	}
+
+	for i, tc := range testCases {
+		disconnected := false
+		q := NewOutputQueue(3, tc.policy, func() { disconnected = true })
+		for _, message := range []string{"a", "b", "c", "d"} {
+			q.Push(message)
+		}
+
+		if got := strings.Join(popAll(q), " "); got != tc.want {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, got, tc.want)
+		}
+		if disconnected != tc.disconnected {
+			t.Fatalf("Testcase %d: Got disconnected %v, expected %v", i, disconnected, tc.disconnected)
+		}
+	}
+}
+
+func TestOutputQueueDropsMessagesAfterClose(t *testing.T) {
+	q := NewOutputQueue(3, DropOldest, nil)
+	q.Push("a")
+	q.Close()
+	q.Push("b")
+
+	if got := strings.Join(popAll(q), " "); got != "a" {
+		t.Fatalf("Got %q, expected the queued message only", got)
+	}
+}
+
+// joinClient logs in a client which doesn't read anything after the login
+func joinClient(t *testing.T, server *Server, id ClientId, name string) net.Conn {
+	t.Helper()
+	server.idGenerator = fixedIdGenerator(id)
+	conn, serverConn := net.Pipe()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	login(t, conn, bufio.NewReader(conn), name)
+	return conn
+}
+
+// sayRepeatedly makes the client talk in the room where the stalled client is
+func sayRepeatedly(t *testing.T, server *Server, id ClientId, name string, times int) net.Conn {
+	t.Helper()
+	conn := joinClient(t, server, id, name)
+	reader := bufio.NewReader(conn)
+	// a stalled world makes the write or the read time out
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < times; i++ {
+		if _, err := conn.Write([]byte("say hello\n")); err != nil {
+			t.Fatalf("say %d failed: %v", i, err)
+		}
+		readUntil(t, reader, "You said hello")
+	}
+	return conn
+}
+
+func TestSlowClientDoesNotStallTheWorld(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	server := NewServer(fixedIdGenerator(""), world, WithOutputOptions(OutputOptions{
+		QueueSize: 4,
+		Policy:    DropOldest,
+	}))
+
+	stalled := joinClient(t, server, "stalled", "abel")
+	defer stalled.Close()
+	talker := sayRepeatedly(t, server, "talker", "bella", 20)
+	defer talker.Close()
+
+	if depth := server.QueueDepths()["stalled"]; depth > 4 {
+		t.Fatalf("Got queue depth %d, expected it to be bounded", depth)
+	}
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	server := NewServer(fixedIdGenerator(""), world, WithOutputOptions(OutputOptions{
+		QueueSize: 4,
+		Policy:    DisconnectSlow,
+	}))
+
+	stalled := joinClient(t, server, "stalled", "abel")
+	defer stalled.Close()
+	talker := sayRepeatedly(t, server, "talker", "bella", 20)
+	defer talker.Close()
+
+	waitFor(t, "the slow client to be removed", func() bool {
+		return server.getClient("stalled") == nil
+	})
+	if hasCharacter(world, "stalled") {
+		t.Fatal("the slow client's character should be removed")
+	}
+}
+
+func TestWriteTimeoutDisconnectsClient(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	server := NewServer(fixedIdGenerator("stalled"), world, WithOutputOptions(OutputOptions{
+		QueueSize:    4,
+		Policy:       DropOldest,
+		WriteTimeout: 10 * time.Millisecond,
+	}))
+
+	// the welcome is never read so its write times out
+	stalled, serverConn := net.Pipe()
+	defer stalled.Close()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the client to be removed", func() bool {
+		return server.getClient("stalled") == nil
+	})
+}
@@ -1,42 +1,150 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/mkauppila/mud/internal/game"
 )
 
+const defaultShutdownCountdown = 5 * time.Second
+
+// DefaultAddress is where the server listens unless told otherwise
+const DefaultAddress = "localhost:6000"
+
 type Server struct {
 	clientsMutex sync.RWMutex
 	clients      map[ClientId]*Client
 	world        game.Worlder
 	idGenerator  IdGenerator
+
+	listenerMutex     sync.Mutex
+	listeners         []net.Listener
+	shuttingDown      bool
+	shutdownCountdown time.Duration
+
+	address        string
+	maxConnections int
+	idleTimeout    time.Duration
+	output         OutputOptions
+	// allowedOrigins are the other web pages which can use the WebSocket
+	allowedOrigins []string
+}
+
+type ErrServerFull struct {
+	max int
+}
+
+func (e ErrServerFull) Error() string {
+	return fmt.Sprintf("server is full with %d clients", e.max)
+}
+
+type ServerOption func(*Server)
+
+// WithAddress sets the address the server listens at
+func WithAddress(address string) ServerOption {
+	return func(s *Server) {
+		s.address = address
+	}
+}
+
+// WithMaxConnections limits how many clients can be connected at once.
+// Zero means no limit.
+func WithMaxConnections(max int) ServerOption {
+	return func(s *Server) {
+		s.maxConnections = max
+	}
+}
+
+// WithIdleTimeout disconnects the clients which send nothing for the
+// duration. Zero means no timeout.
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithOutputOptions sets the size of the clients' output queues, what to do
+// when a queue is full and how long a write may take
+func WithOutputOptions(options OutputOptions) ServerOption {
+	return func(s *Server) {
+		s.output = options
+	}
 }
 
-func NewServer(idGenerator IdGenerator, world game.Worlder) Server {
-	return Server{
-		clientsMutex: sync.RWMutex{},
-		clients:      make(map[ClientId]*Client),
-		world:        world,
-		idGenerator:  idGenerator,
+// WithAllowedOrigins lets the pages of the other origins, e.g.
+// "https://example.com", use the WebSocket. The origin the web client is
+// served from is always allowed.
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		s.allowedOrigins = origins
 	}
 }
 
+type ErrClientsNotClosed struct {
+	ids []ClientId
+}
+
+func (e ErrClientsNotClosed) Error() string {
+	ids := make([]string, len(e.ids))
+	for i, id := range e.ids {
+		ids[i] = string(id)
+	}
+	return fmt.Sprintf("clients not closed in time: %s", strings.Join(ids, ", "))
+}
+
+func NewServer(idGenerator IdGenerator, world game.Worlder, options ...ServerOption) *Server {
+	server := &Server{
+		clientsMutex:      sync.RWMutex{},
+		clients:           make(map[ClientId]*Client),
+		world:             world,
+		idGenerator:       idGenerator,
+		shutdownCountdown: defaultShutdownCountdown,
+		address:           DefaultAddress,
+		output:            DefaultOutputOptions(),
+	}
+	for _, option := range options {
+		option(server)
+	}
+	return server
+}
+
+// AddNewClient adds a client speaking telnet over the connection
 func (s *Server) AddNewClient(conn net.Conn) error {
+	return s.addClient(conn, NewClient)
+}
+
+func (s *Server) addClient(
+	conn net.Conn,
+	newClient func(net.Conn, ClientId, game.Worlder, OutputOptions) *Client,
+) error {
 	clientId, err := s.idGenerator()
 	if err != nil {
 		return err
 	}
 
-	client := NewClient(conn, clientId, s.world)
+	client := newClient(conn, clientId, s.world, s.output)
+	client.idleTimeout = s.idleTimeout
 	s.clientsMutex.Lock()
+	if s.maxConnections > 0 && len(s.clients) >= s.maxConnections {
+		s.clientsMutex.Unlock()
+		return ErrServerFull{max: s.maxConnections}
+	}
 	s.clients[clientId] = client
 	s.clientsMutex.Unlock()
 
-	go client.Listen()
-	go client.Broadcast()
+	go func() {
+		client.Listen()
+		s.removeClient(clientId)
+		client.Disconnect()
+	}()
+	go client.WriteOutput()
 
 	return nil
 }
@@ -58,27 +166,172 @@ func (s *Server) getClient(id ClientId) *Client {
 	}
 }
 
+func (s *Server) allClients() []*Client {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+	clients := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// QueueDepths is the number of messages waiting to be written to each client
+func (s *Server) QueueDepths() map[ClientId]int {
+	depths := make(map[ClientId]int)
+	for _, client := range s.allClients() {
+		depths[client.id] = client.QueueDepth()
+	}
+	return depths
+}
+
 func (s *Server) StartAcceptingConnections() {
-	address := "localhost:6000"
-	fmt.Printf("starting at %s\n", address)
+	fmt.Printf("starting at %s\n", s.address)
 
-	ln, err := net.Listen("tcp", address)
+	ln, err := net.Listen("tcp", s.address)
 	if err != nil {
 		panic(err)
 	}
 	defer ln.Close()
 
+	if !s.addListener(ln) {
+		return
+	}
+	s.acceptConnections(ln, s.addAcceptedClient)
+}
+
+// addListener keeps the listener to be closed on shutdown. False is returned
+// if the server is already shutting down.
+func (s *Server) addListener(ln net.Listener) bool {
+	s.listenerMutex.Lock()
+	defer s.listenerMutex.Unlock()
+	if s.shuttingDown {
+		return false
+	}
+	s.listeners = append(s.listeners, ln)
+	return true
+}
+
+const serverFullMessage = "The server is full, please try again later\n"
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// acceptConnections accepts until the listener is closed and handles each
+// connection in its own goroutine. Failed accepts are retried with an
+// increasing delay instead of giving up.
+func (s *Server) acceptConnections(ln net.Listener, handle func(conn net.Conn)) {
+	var backoff time.Duration
 	for {
 		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
-			panic(err)
+			if backoff == 0 {
+				backoff = minAcceptBackoff
+			} else if backoff *= 2; backoff > maxAcceptBackoff {
+				backoff = maxAcceptBackoff
+			}
+			fmt.Printf("Failed to accept a connection, retrying in %v: %v\n", backoff, err)
+			time.Sleep(backoff)
+			continue
 		}
+		backoff = 0
 
-		go func() {
-			err := s.AddNewClient(conn)
-			if err != nil {
-				panic(err)
-			}
-		}()
+		go handle(conn)
+	}
+}
+
+// addAcceptedClient adds the client of the accepted connection. The client
+// is told if the server is full.
+func (s *Server) addAcceptedClient(conn net.Conn) {
+	err := s.AddNewClient(conn)
+	var full ErrServerFull
+	if errors.As(err, &full) {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		conn.Write([]byte(serverFullMessage))
+	}
+	if err != nil {
+		fmt.Printf("Failed to add a client: %v\n", err)
+		conn.Close()
+	}
+}
+
+// Shutdown stops accepting new connections, warns the connected players
+// with a countdown and then closes every client. If the context is done
+// before all the clients are closed the ones left are reported in the error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.listenerMutex.Lock()
+	s.shuttingDown = true
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	s.listenerMutex.Unlock()
+
+	s.countdown(ctx)
+	if s.shutdownCountdown > 0 {
+		// the warnings are only queued, they have to reach the clients
+		// before the connections are closed
+		s.waitForWorld(ctx)
+	}
+
+	clients := s.allClients()
+	for _, client := range clients {
+		client.output.Close()
+	}
+	for _, client := range clients {
+		select {
+		case <-client.written:
+		case <-ctx.Done():
+		}
+		client.Close()
+	}
+
+	var notClosed []ClientId
+	for _, client := range clients {
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			notClosed = append(notClosed, client.id)
+		}
+	}
+
+	if len(notClosed) > 0 {
+		return ErrClientsNotClosed{ids: notClosed}
+	}
+	return nil
+}
+
+// waitForWorld waits until the world has run the actions queued so far
+func (s *Server) waitForWorld(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.world.Do(func(*game.World) {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (s *Server) countdown(ctx context.Context) {
+	left := s.shutdownCountdown
+	for left > 0 {
+		s.world.Announce(fmt.Sprintf("The server is shutting down in %d seconds\n", int(math.Ceil(left.Seconds()))))
+
+		step := time.Second
+		if left < step {
+			step = left
+		}
+		select {
+		case <-time.After(step):
+			left -= step
+		case <-ctx.Done():
+			return
+		}
 	}
 }
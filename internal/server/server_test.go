@@ -0,0 +1,445 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mkauppila/mud/internal/game"
+)
+
+func fixedIdGenerator(id ClientId) IdGenerator {
+	return func() (ClientId, error) {
+		return id, nil
+	}
+}
+
+func readUntil(t *testing.T, reader *bufio.Reader, want string) {
+	t.Helper()
+	var read string
+	for !strings.Contains(read, want) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading %q failed: %v. Got so far: %q", want, err, read)
+		}
+		read += line
+	}
+}
+
+// login creates a new account and a character with the same name
+func login(t *testing.T, conn net.Conn, reader *bufio.Reader, name string) {
+	t.Helper()
+	readUntil(t, reader, "What's your account name?")
+	for _, step := range []struct{ input, want string }{
+		{name, "Pick a password"},
+		{"secret", "Confirm the password"},
+		{"secret", "Name your first character"},
+		{name, "You look around"},
+	} {
+		if _, err := conn.Write([]byte(step.input + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		readUntil(t, reader, step.want)
+	}
+}
+
+// hasCharacter checks the world on the game loop while it's running
+func hasCharacter(world *game.World, id ClientId) bool {
+	var found bool
+	world.Do(func(w *game.World) {
+		found = w.GetCharacter(game.ClientId(id)) != nil
+	})
+	return found
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientDisconnectCleansUp(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+
+	var id ClientId = "client"
+	server := NewServer(fixedIdGenerator(id), world)
+
+	baseline := runtime.NumGoroutine()
+
+	conn, serverConn := net.Pipe()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	login(t, conn, reader, "abel")
+
+	if !hasCharacter(world, id) {
+		t.Fatal("character should be in the world after login")
+	}
+
+	conn.Close()
+
+	waitFor(t, "client to be removed", func() bool {
+		return server.getClient(id) == nil
+	})
+	if hasCharacter(world, id) {
+		t.Fatal("character should be removed from the world")
+	}
+	var hasAccount bool
+	world.Do(func(w *game.World) {
+		hasAccount = w.GetAccount(game.ClientId(id)) != nil
+	})
+	if hasAccount {
+		t.Fatal("account should be removed from the world")
+	}
+	waitFor(t, "client goroutines to exit", func() bool {
+		return runtime.NumGoroutine() <= baseline
+	})
+}
+
+func TestTelnetClientGetsGMCP(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	server := NewServer(fixedIdGenerator("client"), world)
+	conn, serverConn := net.Pipe()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+
+	if _, err := conn.Write([]byte{telnetIAC, telnetDO, optionGMCP}); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, reader, "What's your account name?")
+	for _, step := range []struct{ input, want string }{
+		{"abel", "Pick a password"},
+		{"secret", "Confirm the password"},
+		{"secret", "Name your first character"},
+	} {
+		if _, err := conn.Write([]byte(step.input + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		readUntil(t, reader, step.want)
+	}
+
+	// the events follow the look and don't end in a newline
+	if _, err := conn.Write([]byte("abel\n")); err != nil {
+		t.Fatal(err)
+	}
+	var read []byte
+	roomInfoRead := func() bool {
+		i := bytes.Index(read, []byte("Room.Info"))
+		return i >= 0 && bytes.Contains(read[i:], []byte{telnetIAC, telnetSE})
+	}
+	for !bytes.Contains(read, []byte("You look around")) || !roomInfoRead() {
+		b, err := reader.ReadByte()
+		if err != nil {
+			t.Fatalf("reading the events failed: %v. Got so far: %q", err, read)
+		}
+		read = append(read, b)
+	}
+	for _, want := range []string{`Char.Vitals {"hp":30,"maxhp":30}`, `Char.Status {"name":"abel"`, `Room.Info {"num":`} {
+		if !bytes.Contains(read, []byte(want)) {
+			t.Fatalf("Got %q, expected it to contain %q", read, want)
+		}
+	}
+}
+
+type blockingWorld struct{}
+
+func (blockingWorld) ClientJoined(
+	clientId game.ClientId,
+	connection game.Connection,
+	output func(message string),
+) {
+}
+func (blockingWorld) ClientDisconnected(game.ClientId) bool          { return true }
+func (blockingWorld) PassMessageToClient(string, game.ClientId) bool { return true }
+func (blockingWorld) Announce(string)                                {}
+func (blockingWorld) Do(func(*game.World))                           {}
+
+// wordsWorld replies to every input with each of its words separately. It's
+// called by the client's Listen alone.
+type wordsWorld struct {
+	connection game.Connection
+	output     func(message string)
+}
+
+func (w *wordsWorld) ClientJoined(
+	clientId game.ClientId,
+	connection game.Connection,
+	output func(message string),
+) {
+	w.connection = connection
+	w.output = output
+}
+func (w *wordsWorld) ClientDisconnected(game.ClientId) bool {
+	w.connection.InputDone()
+	return true
+}
+func (w *wordsWorld) PassMessageToClient(input string, id game.ClientId) bool {
+	for _, word := range strings.Fields(input) {
+		w.output(word + "\n")
+	}
+	w.connection.InputDone()
+	return true
+}
+func (w *wordsWorld) Announce(string)      {}
+func (w *wordsWorld) Do(func(*game.World)) {}
+
+func TestClientKeepsUpWithManyReplies(t *testing.T) {
+	server := NewServer(fixedIdGenerator("client"), &wordsWorld{})
+	conn, serverConn := net.Pipe()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+
+	for _, input := range []string{"one two three four", "five", "six seven"} {
+		if _, err := conn.Write([]byte(input + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		for _, word := range strings.Fields(input) {
+			readUntil(t, reader, word)
+		}
+	}
+}
+
+func TestClientGetsAllItemsFromACorpse(t *testing.T) {
+	areas, err := game.LoadAreas(fstest.MapFS{"cellar.json": {Data: []byte(`{
+		"name": "cellar",
+		"items": [
+			{"id": "cheese", "keywords": ["cheese"], "short": "some cheese", "weight": 1},
+			{"id": "bread", "keywords": ["bread"], "short": "a crust of bread", "weight": 1},
+			{"id": "coin", "keywords": ["coin"], "short": "a coin", "weight": 1},
+			{"id": "button", "keywords": ["button"], "short": "a button", "weight": 1}
+		],
+		"mobs": [
+			{"id": "rat", "name": "the rat", "keywords": ["rat"], "long": "A rat squeaks.",
+			 "stats": {"maxHealth": 1}, "items": ["cheese", "bread", "coin", "button"]}
+		],
+		"rooms": [
+			{"id": "cellar", "title": "Cellar", "flags": ["start"], "mobs": ["rat"]}
+		]
+	}`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	world := game.NewWorld(game.WithAreas(areas), game.WithTimeStep(10*time.Millisecond))
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	server := NewServer(fixedIdGenerator("client"), world)
+	conn, serverConn := net.Pipe()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	login(t, conn, reader, "abel")
+
+	for _, step := range []struct {
+		input string
+		want  []string
+	}{
+		{input: "kill rat", want: []string{"You killed the rat!"}},
+		{input: "get all from corpse", want: []string{
+			"You get some cheese from the corpse of the rat",
+			"You get a crust of bread from the corpse of the rat",
+			"You get a coin from the corpse of the rat",
+			"You get a button from the corpse of the rat",
+		}},
+		// the reply to the next command is not behind
+		{input: "inventory", want: []string{"You are carrying:"}},
+		{input: "say done", want: []string{"You said done"}},
+	} {
+		if _, err := conn.Write([]byte(step.input + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range step.want {
+			readUntil(t, reader, want)
+		}
+	}
+}
+
+func TestShutdownWarnsAndClosesClients(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+
+	var id ClientId = "client"
+	server := NewServer(fixedIdGenerator(id), world)
+	server.shutdownCountdown = time.Second
+
+	conn, serverConn := net.Pipe()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	login(t, conn, reader, "abel")
+
+	output := make(chan string)
+	go func() {
+		all, _ := io.ReadAll(reader)
+		output <- string(all)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	world.Stop()
+
+	if got := <-output; !strings.Contains(got, "shutting down in 1 seconds") {
+		t.Fatalf("players should be warned about the shutdown, got %q", got)
+	}
+	if server.getClient(id) != nil {
+		t.Fatal("client should be removed")
+	}
+	if world.GetCharacter(game.ClientId(id)) != nil {
+		t.Fatal("character should be removed from the world")
+	}
+}
+
+func TestShutdownReportsClientsNotClosedInTime(t *testing.T) {
+	var id ClientId = "stuck"
+	server := NewServer(fixedIdGenerator(id), blockingWorld{})
+	server.shutdownCountdown = 0
+
+	_, serverConn := net.Pipe()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := server.Shutdown(ctx)
+
+	var notClosed ErrClientsNotClosed
+	if !errors.As(err, &notClosed) {
+		t.Fatalf("expected ErrClientsNotClosed, got %v", err)
+	}
+	if len(notClosed.ids) != 1 || notClosed.ids[0] != id {
+		t.Fatalf("expected %s to be reported, got %v", id, notClosed.ids)
+	}
+}
+
+func TestClientOfAStoppedWorldIsRemoved(t *testing.T) {
+	var id ClientId = "client"
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	world.Stop()
+	server := NewServer(fixedIdGenerator(id), world)
+
+	clientConn, serverConn := net.Pipe()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, clientConn)
+	if _, err := clientConn.Write([]byte("look\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	clientConn.Close()
+
+	waitFor(t, "the client to be removed", func() bool {
+		return server.getClient(id) == nil
+	})
+}
+
+// flakyListener fails the first accepts and then returns the connection
+type flakyListener struct {
+	failures int
+	conn     net.Conn
+	accepts  int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	l.accepts++
+	switch {
+	case l.accepts <= l.failures:
+		return nil, errors.New("too many open files")
+	case l.conn != nil:
+		conn := l.conn
+		l.conn = nil
+		return conn, nil
+	default:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *flakyListener) Close() error   { return nil }
+func (l *flakyListener) Addr() net.Addr { return nil }
+
+func TestAcceptErrorsAreRetried(t *testing.T) {
+	var id ClientId = "client"
+	server := NewServer(fixedIdGenerator(id), blockingWorld{})
+	_, serverConn := net.Pipe()
+	listener := &flakyListener{failures: 3, conn: serverConn}
+
+	server.acceptConnections(listener, server.addAcceptedClient)
+
+	if listener.accepts != 5 {
+		t.Fatalf("Got %d accepts, expected the failures to be retried", listener.accepts)
+	}
+	waitFor(t, "client to be added", func() bool {
+		return server.getClient(id) != nil
+	})
+}
+
+func TestServerRefusesClientsOverTheLimit(t *testing.T) {
+	server := NewServer(fixedIdGenerator("first"), blockingWorld{}, WithMaxConnections(1))
+	_, serverConn := net.Pipe()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+
+	server.idGenerator = fixedIdGenerator("second")
+	_, serverConn = net.Pipe()
+	var full ErrServerFull
+	if err := server.AddNewClient(serverConn); !errors.As(err, &full) {
+		t.Fatalf("Got %v, expected ErrServerFull", err)
+	}
+	if server.getClient("second") != nil {
+		t.Fatal("the client over the limit should not be added")
+	}
+}
+
+func TestIdleClientIsDisconnected(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	var id ClientId = "idle"
+	server := NewServer(fixedIdGenerator(id), world, WithIdleTimeout(50*time.Millisecond))
+	conn, serverConn := net.Pipe()
+	defer conn.Close()
+	if err := server.AddNewClient(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, conn)
+
+	waitFor(t, "the idle client to be removed", func() bool {
+		return server.getClient(id) == nil
+	})
+}
@@ -0,0 +1,408 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mkauppila/mud/internal/game"
+	"golang.org/x/crypto/ssh"
+)
+
+const maxSSHAuthTries = 3
+
+// sshHandshakeTimeout is how long the client has to authenticate
+var sshHandshakeTimeout = 30 * time.Second
+
+var ErrSSHAuthFailed = errors.New("ssh authentication failed")
+
+// AccountLookup finds the stored account for checking the SSH credentials
+type AccountLookup func(name string) (game.AccountData, error)
+
+// LoadOrCreateHostKey reads the SSH host key from the file. A new ed25519
+// key is generated and saved if the file doesn't exist.
+func LoadOrCreateHostKey(path string) (ssh.Signer, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		contents, err = newHostKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(contents)
+}
+
+func newHostKey(path string) ([]byte, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	contents := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Generated a new SSH host key to %s\n", path)
+	return contents, nil
+}
+
+// NewSSHConfig authenticates the SSH user as the MUD account of the same
+// name with the account's password or one of its public keys
+func NewSSHConfig(hostKey ssh.Signer, accounts AccountLookup) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		MaxAuthTries: maxSSHAuthTries,
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			data, err := accounts(meta.User())
+			if err != nil || !game.CheckPassword(data, string(password)) {
+				return nil, ErrSSHAuthFailed
+			}
+			return sshPermissions(data), nil
+		},
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			data, err := accounts(meta.User())
+			if err != nil || !hasPublicKey(data, key) {
+				return nil, ErrSSHAuthFailed
+			}
+			return sshPermissions(data), nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	return config
+}
+
+func sshPermissions(data game.AccountData) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{"account": data.Name}}
+}
+
+func hasPublicKey(data game.AccountData, key ssh.PublicKey) bool {
+	for _, line := range data.PublicKeys {
+		registered, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			fmt.Printf("Invalid public key of %s: %v\n", data.Name, err)
+			continue
+		}
+		if bytes.Equal(registered.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartSSHListener accepts SSH sessions at the address next to the other
+// listeners
+func (s *Server) StartSSHListener(address string, config *ssh.ServerConfig) {
+	fmt.Printf("starting SSH at %s\n", address)
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		panic(err)
+	}
+	s.ServeSSH(ln, config)
+}
+
+// ServeSSH accepts the SSH connections from the listener until the server
+// is shut down. Every connection can have one shell session which joins the
+// world as a client.
+func (s *Server) ServeSSH(ln net.Listener, config *ssh.ServerConfig) {
+	defer ln.Close()
+
+	if !s.addListener(ln) {
+		return
+	}
+	s.acceptConnections(ln, func(conn net.Conn) {
+		s.handleSSH(conn, config)
+	})
+}
+
+func (s *Server) handleSSH(conn net.Conn, config *ssh.ServerConfig) {
+	// a client which stalls in the handshake is dropped
+	conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		fmt.Printf("SSH handshake with %s failed: %v\n", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(requests)
+
+	started := false
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" || started {
+			newChannel.Reject(ssh.Prohibited, "only one session is supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			fmt.Printf("Failed to accept the SSH session: %v\n", err)
+			continue
+		}
+		started = true
+
+		session := newSSHSession(channel, serverConn, conn)
+		go session.handleRequests(s, channelRequests, serverConn.Permissions.Extensions["account"])
+	}
+}
+
+// sshSession is the connection and the terminal of an SSH client. As there
+// isn't a real pty the session echoes the input and edits the line itself.
+type sshSession struct {
+	channel    ssh.Channel
+	serverConn *ssh.ServerConn
+	// conn is the TCP connection used for the deadlines
+	conn net.Conn
+
+	mutex        sync.Mutex
+	pty          bool
+	terminalType string
+	width        int
+	height       int
+	echo         bool
+	// output is where the echo is written, the client's output queue
+	output io.Writer
+
+	line    []byte
+	input   []byte
+	escape  bool
+	afterCR bool
+}
+
+func newSSHSession(channel ssh.Channel, serverConn *ssh.ServerConn, conn net.Conn) *sshSession {
+	return &sshSession{
+		channel:    channel,
+		serverConn: serverConn,
+		conn:       conn,
+		echo:       true,
+	}
+}
+
+func (s *sshSession) handleRequests(server *Server, requests <-chan *ssh.Request, account string) {
+	for request := range requests {
+		ok := false
+		switch request.Type {
+		case "pty-req":
+			ok = s.setPty(request.Payload)
+		case "window-change":
+			ok = s.setWindowSize(request.Payload)
+		case "shell":
+			ok = s.start(server, account)
+		}
+		if request.WantReply {
+			request.Reply(ok, nil)
+		}
+	}
+}
+
+func (s *sshSession) start(server *Server, account string) bool {
+	s.mutex.Lock()
+	if s.output != nil {
+		s.mutex.Unlock()
+		return false
+	}
+	s.output = io.Discard
+	s.mutex.Unlock()
+
+	err := server.addClient(s, func(conn net.Conn, id ClientId, world game.Worlder, options OutputOptions) *Client {
+		client := newClient(conn, id, world, options)
+		client.terminal = s
+		client.account = account
+		s.mutex.Lock()
+		s.output = queueWriter{client.output}
+		s.mutex.Unlock()
+		return client
+	})
+	if err != nil {
+		fmt.Printf("Failed to add an SSH client: %v\n", err)
+		var full ErrServerFull
+		if errors.As(err, &full) {
+			s.Write([]byte(serverFullMessage))
+		}
+		s.Close()
+		return false
+	}
+	return true
+}
+
+// setPty reads the pty-req payload (RFC 4254 6.2)
+func (s *sshSession) setPty(payload []byte) bool {
+	term, rest, ok := parseSSHString(payload)
+	if !ok || len(rest) < 8 {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pty = true
+	s.terminalType = term
+	s.width = int(binary.BigEndian.Uint32(rest))
+	s.height = int(binary.BigEndian.Uint32(rest[4:]))
+	return true
+}
+
+// setWindowSize reads the window-change payload (RFC 4254 6.7)
+func (s *sshSession) setWindowSize(payload []byte) bool {
+	if len(payload) < 8 {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.width = int(binary.BigEndian.Uint32(payload))
+	s.height = int(binary.BigEndian.Uint32(payload[4:]))
+	return true
+}
+
+func parseSSHString(data []byte) (string, []byte, bool) {
+	if len(data) < 4 {
+		return "", nil, false
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < length {
+		return "", nil, false
+	}
+	return string(data[4 : 4+length]), data[4+length:], true
+}
+
+func (s *sshSession) Negotiate() error { return nil }
+
+func (s *sshSession) SuppressEcho(suppress bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.echo = !suppress
+}
+
+func (s *sshSession) WindowSize() (width, height int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.width, s.height
+}
+
+func (s *sshSession) TerminalType() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.terminalType
+}
+
+// SendEvent drops the event as SSH has no out-of-band channel for it
+func (s *sshSession) SendEvent(game.Event) {}
+
+// Read returns the input line by line. With a pty the input is edited and
+// echoed here, without one it's passed as is.
+func (s *sshSession) Read(p []byte) (int, error) {
+	buf := make([]byte, 256)
+	for len(s.input) == 0 {
+		n, err := s.channel.Read(buf)
+		if n > 0 {
+			if err := s.edit(buf[:n]); err != nil {
+				return 0, err
+			}
+		}
+		if err != nil && len(s.input) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, s.input)
+	s.input = s.input[n:]
+	return n, nil
+}
+
+func (s *sshSession) edit(data []byte) error {
+	s.mutex.Lock()
+	pty, echo, output := s.pty, s.echo, s.output
+	s.mutex.Unlock()
+
+	if !pty {
+		s.input = append(s.input, data...)
+		return nil
+	}
+
+	var echoed []byte
+	for _, b := range data {
+		switch {
+		case s.escape:
+			// the escape sequences of e.g. the arrow keys end in a letter
+			if b >= 0x40 && b <= 0x7e && b != '[' {
+				s.escape = false
+			}
+		case b == 0x1b:
+			s.escape = true
+		case b == '\n' && s.afterCR:
+		case b == '\r' || b == '\n':
+			s.input = append(s.input, s.line...)
+			s.input = append(s.input, '\n')
+			s.line = s.line[:0]
+			echoed = append(echoed, '\n')
+		case b == 0x7f || b == 0x08:
+			if len(s.line) > 0 {
+				_, size := utf8.DecodeLastRune(s.line)
+				s.line = s.line[:len(s.line)-size]
+				if echo {
+					echoed = append(echoed, "\b \b"...)
+				}
+			}
+		case b == 0x03 || (b == 0x04 && len(s.line) == 0):
+			// ctrl-c or ctrl-d on an empty line
+			return io.EOF
+		case b >= 0x20:
+			s.line = append(s.line, b)
+			if echo {
+				echoed = append(echoed, b)
+			}
+		}
+		s.afterCR = b == '\r'
+	}
+
+	if len(echoed) > 0 && output != nil {
+		output.Write(echoed)
+	}
+	return nil
+}
+
+// Write sends the output to the channel. A pty expects the lines to end in
+// \r\n.
+func (s *sshSession) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	pty := s.pty
+	s.mutex.Unlock()
+
+	data := p
+	if pty {
+		data = []byte(strings.ReplaceAll(string(p), "\n", "\r\n"))
+	}
+	if _, err := s.channel.Write(data); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection before the channel. The channel's close is
+// sent to the client which could block if the client has stopped reading.
+func (s *sshSession) Close() error {
+	err := s.serverConn.Close()
+	s.channel.Close()
+	return err
+}
+
+func (s *sshSession) LocalAddr() net.Addr                { return s.serverConn.LocalAddr() }
+func (s *sshSession) RemoteAddr() net.Addr               { return s.serverConn.RemoteAddr() }
+func (s *sshSession) SetDeadline(t time.Time) error      { return s.conn.SetDeadline(t) }
+func (s *sshSession) SetReadDeadline(t time.Time) error  { return s.conn.SetReadDeadline(t) }
+func (s *sshSession) SetWriteDeadline(t time.Time) error { return s.conn.SetWriteDeadline(t) }
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkauppila/mud/internal/game"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer runs a world with the account abel, which has a character
+// Abel, and the password secret
+func startSSHServer(t *testing.T, id ClientId, publicKeys ...string) (*Server, *game.World, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startSSHServerWith(t, id, ln, nil, publicKeys...)
+}
+
+func startSSHServerWith(t *testing.T, id ClientId, ln net.Listener, options []ServerOption, publicKeys ...string) (*Server, *game.World, string) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := game.NewMemoryAccountStore()
+	store.SaveAccount(game.AccountData{
+		Name:         "abel",
+		PasswordHash: hash,
+		Characters:   []string{"Abel"},
+		PublicKeys:   publicKeys,
+	})
+	world := game.NewWorld(game.WithAccountStore(store))
+	go world.RunGameLoop()
+	t.Cleanup(world.Stop)
+
+	hostKey, err := LoadOrCreateHostKey(filepath.Join(t.TempDir(), "keys", "ssh_host_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	server := NewServer(fixedIdGenerator(id), world, options...)
+	go server.ServeSSH(ln, NewSSHConfig(hostKey, world.LoadAccount))
+	return server, world, ln.Addr().String()
+}
+
+func dialSSH(address string, auth ssh.AuthMethod) (*ssh.Client, error) {
+	return ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            "abel",
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+}
+
+// startShell opens a session with a pty and waits for the character prompt
+func startShell(t *testing.T, client *ssh.Client) (*ssh.Session, *bufio.Reader, func(string)) {
+	t.Helper()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(stdout)
+	readUntil(t, reader, "Welcome back")
+	send := func(input string) {
+		if _, err := stdin.Write([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return session, reader, send
+}
+
+func TestSSHClientLogsInWithThePassword(t *testing.T) {
+	var id ClientId = "ssh"
+	server, world, address := startSSHServer(t, id)
+
+	client, err := dialSSH(address, ssh.Password("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	session, reader, send := startShell(t, client)
+	readUntil(t, reader, "Your characters: Abel")
+	send("abel\r")
+	readUntil(t, reader, "You look around")
+
+	if !hasCharacter(world, id) {
+		t.Fatal("the SSH client should be playing")
+	}
+	if width, height := server.getClient(id).WindowSize(); width != 80 || height != 24 {
+		t.Fatalf("Got %dx%d, expected 80x24", width, height)
+	}
+
+	if err := session.WindowChange(40, 120); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the window size", func() bool {
+		width, height := server.getClient(id).WindowSize()
+		return width == 120 && height == 40
+	})
+}
+
+func TestSSHClientLogsInWithAPublicKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+
+	var id ClientId = "ssh"
+	_, world, address := startSSHServer(t, id, authorized)
+
+	client, err := dialSSH(address, ssh.PublicKeys(signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	_, reader, send := startShell(t, client)
+	send("abel\r")
+	readUntil(t, reader, "You look around")
+
+	if !hasCharacter(world, id) {
+		t.Fatal("the SSH client should be playing")
+	}
+}
+
+// smallBufferListener shrinks the send buffers of the connections so that
+// they are filled quickly by a client which doesn't read
+type smallBufferListener struct {
+	net.Listener
+}
+
+func (l smallBufferListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetWriteBuffer(4096)
+	}
+	return conn, err
+}
+
+// stallingConn stops reading once stalled like a client whose network is
+// stuck
+type stallingConn struct {
+	net.Conn
+	stalled chan struct{}
+	closed  chan struct{}
+}
+
+func (c *stallingConn) Read(p []byte) (int, error) {
+	select {
+	case <-c.stalled:
+		<-c.closed
+		return 0, net.ErrClosed
+	default:
+		return c.Conn.Read(p)
+	}
+}
+
+func TestSSHClientWhichStopsReadingDoesntStopTheWorld(t *testing.T) {
+	var id ClientId = "ssh"
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without a write timeout only the close can free the stuck writer
+	options := []ServerOption{WithOutputOptions(OutputOptions{QueueSize: 4, Policy: DisconnectSlow})}
+	server, world, address := startSSHServerWith(t, id, smallBufferListener{ln}, options)
+
+	tcp, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp.(*net.TCPConn).SetReadBuffer(4096)
+	conn := &stallingConn{Conn: tcp, stalled: make(chan struct{}), closed: make(chan struct{})}
+	t.Cleanup(func() {
+		close(conn.closed)
+		tcp.Close()
+	})
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, address, &ssh.ClientConfig{
+		User:            "abel",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reader, send := startShell(t, ssh.NewClient(sshConn, channels, requests))
+	send("abel\r")
+	readUntil(t, reader, "You look around")
+
+	client := server.getClient(id)
+	close(conn.stalled)
+	running := make(chan struct{})
+	go func() {
+		// far more than the SSH window and the socket buffers take. The queue
+		// is let to drain so that it fills only once the writer is stuck.
+		message := strings.Repeat("x", 32*1024) + "\n"
+		for i := 0; i < 512 && server.getClient(id) != nil; i++ {
+			world.Announce(message)
+			world.Do(func(*game.World) {})
+			for wait := 0; wait < 50 && client.QueueDepth() > 0; wait++ {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		close(running)
+	}()
+
+	select {
+	case <-running:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the world should keep running while the client is stuck")
+	}
+	waitFor(t, "the slow client to be removed", func() bool {
+		return server.getClient(id) == nil
+	})
+}
+
+func TestSSHRefusesWrongCredentials(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, address := startSSHServer(t, "ssh")
+
+	for i, auth := range []ssh.AuthMethod{
+		ssh.Password("wrong"),
+		ssh.PublicKeys(signer),
+	} {
+		if client, err := dialSSH(address, auth); err == nil {
+			client.Close()
+			t.Fatalf("Testcase %d: expected the login to be refused", i)
+		}
+	}
+}
+
+func TestSSHDropsStalledHandshakes(t *testing.T) {
+	timeout := sshHandshakeTimeout
+	sshHandshakeTimeout = 50 * time.Millisecond
+	defer func() { sshHandshakeTimeout = timeout }()
+	_, _, address := startSSHServer(t, "ssh")
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// the client never answers to the server's version
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("Got %v, expected the server to close the connection", err)
+	}
+}
+
+func TestSSHLineEditing(t *testing.T) {
+	testCases := []struct {
+		input string
+		line  string
+		echo  string
+	}{
+		{input: "look\r", line: "look\n", echo: "look\n"},
+		{input: "look\r\n", line: "look\n", echo: "look\n"},
+		{input: "lookk\x7f\r", line: "look\n", echo: "lookk\b \b\n"},
+		{input: "lo\x1b[Dok\r", line: "look\n", echo: "look\n"},
+		{input: "\x7fsay hi\r", line: "say hi\n", echo: "say hi\n"},
+	}
+
+	for i, tc := range testCases {
+		var echo echoRecorder
+		session := &sshSession{pty: true, echo: true, output: &echo}
+		if err := session.edit([]byte(tc.input)); err != nil {
+			t.Fatalf("Testcase %d: %v", i, err)
+		}
+		if string(session.input) != tc.line {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, session.input, tc.line)
+		}
+		if string(echo) != tc.echo {
+			t.Fatalf("Testcase %d: Got echo %q, expected %q", i, echo, tc.echo)
+		}
+	}
+}
+
+type echoRecorder []byte
+
+func (r *echoRecorder) Write(p []byte) (int, error) {
+	*r = append(*r, p...)
+	return len(p), nil
+}
@@ -0,0 +1,418 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mkauppila/mud/internal/game"
+)
+
+// Telnet commands, see RFC 854
+const (
+	telnetSE   byte = 240
+	telnetNOP  byte = 241
+	telnetGA   byte = 249
+	telnetSB   byte = 250
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255
+)
+
+// Telnet options
+const (
+	optionEcho  byte = 1
+	optionSGA   byte = 3
+	optionTTYPE byte = 24
+	optionNAWS  byte = 31
+	// optionGMCP carries the JSON messages of the Generic MUD Communication
+	// Protocol, see https://www.gammon.com.au/gmcp
+	optionGMCP byte = 201
+)
+
+// TTYPE subnegotiation commands, see RFC 1091
+const (
+	ttypeIs   byte = 0
+	ttypeSend byte = 1
+)
+
+// maxSubnegotiation is the longest subnegotiation kept, a longer one is
+// dropped so that the client can't make the buffer grow without a limit
+const maxSubnegotiation = 4096
+
+type telnetState int
+
+const (
+	stateData telnetState = iota
+	stateIAC
+	stateOption
+	stateSubnegotiation
+	stateSubnegotiationIAC
+)
+
+// TelnetOptions are the options negotiated with the client
+type TelnetOptions struct {
+	// Echo is set when the server echoes the input, which means the
+	// client has stopped echoing it locally
+	Echo            bool
+	SuppressGoAhead bool
+	NAWS            bool
+	Width, Height   int
+	TTYPE           bool
+	TerminalType    string
+	// GMCP is set once the client has agreed to receive the events
+	GMCP bool
+	// ClientName and ClientVersion are told in the GMCP Core.Hello
+	ClientName    string
+	ClientVersion string
+}
+
+// Telnet strips the telnet commands from the read data and answers to the
+// option negotiation. Only the plain data is returned from Read.
+type Telnet struct {
+	reader io.Reader
+	writer io.Writer
+
+	state          telnetState
+	command        byte
+	subnegotiation []byte
+
+	mutex sync.Mutex
+	// options enabled on our and on the client's side
+	local, remote map[byte]bool
+	// options we've asked for and are waiting an answer to
+	pendingLocal, pendingRemote map[byte]bool
+	options                     TelnetOptions
+	output                      []byte
+}
+
+var supportedLocalOptions = map[byte]bool{
+	optionEcho: true,
+	optionSGA:  true,
+	optionGMCP: true,
+}
+
+var supportedRemoteOptions = map[byte]bool{
+	optionNAWS:  true,
+	optionTTYPE: true,
+}
+
+func NewTelnet(reader io.Reader, writer io.Writer) *Telnet {
+	return &Telnet{
+		reader:        reader,
+		writer:        writer,
+		state:         stateData,
+		local:         make(map[byte]bool),
+		remote:        make(map[byte]bool),
+		pendingLocal:  make(map[byte]bool),
+		pendingRemote: make(map[byte]bool),
+	}
+}
+
+// Negotiate asks the client for the options the server wants to use
+func (t *Telnet) Negotiate() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.requestLocal(optionSGA, true)
+	t.requestRemote(optionNAWS, true)
+	t.requestRemote(optionTTYPE, true)
+	t.requestLocal(optionGMCP, true)
+
+	return t.flush()
+}
+
+// SuppressEcho asks the client to stop (or to resume) echoing the input
+// locally, e.g. while the user types a password.
+func (t *Telnet) SuppressEcho(suppress bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.requestLocal(optionEcho, suppress)
+	if err := t.flush(); err != nil {
+		fmt.Println("Failed to write telnet negotiation")
+	}
+}
+
+// SendEvent sends the event as a GMCP message. It's dropped if the client
+// hasn't agreed to GMCP.
+func (t *Telnet) SendEvent(event game.Event) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.options.GMCP {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("Failed to encode %s: %v\n", event.EventName(), err)
+		return
+	}
+	t.sendGMCP(event.EventName(), data)
+	if err := t.flush(); err != nil {
+		fmt.Println("Failed to write GMCP")
+	}
+}
+
+func (t *Telnet) WindowSize() (width, height int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.options.Width, t.options.Height
+}
+
+func (t *Telnet) TerminalType() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.options.TerminalType
+}
+
+func (t *Telnet) Options() TelnetOptions {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.options
+}
+
+func (t *Telnet) Read(p []byte) (int, error) {
+	for {
+		n, err := t.reader.Read(p)
+
+		t.mutex.Lock()
+		n = t.decode(p[:n])
+		flushErr := t.flush()
+		t.mutex.Unlock()
+
+		if err != nil {
+			return n, err
+		}
+		if flushErr != nil {
+			return n, flushErr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// decode strips the telnet commands from data in place and returns the
+// length of the plain data left
+func (t *Telnet) decode(data []byte) int {
+	n := 0
+	for _, b := range data {
+		switch t.state {
+		case stateData:
+			if b == telnetIAC {
+				t.state = stateIAC
+			} else if b != 0 {
+				data[n] = b
+				n++
+			}
+		case stateIAC:
+			switch b {
+			case telnetIAC:
+				data[n] = b
+				n++
+				t.state = stateData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.command = b
+				t.state = stateOption
+			case telnetSB:
+				t.subnegotiation = t.subnegotiation[:0]
+				t.state = stateSubnegotiation
+			default:
+				// NOP, GA and the rest carry no meaning for us
+				t.state = stateData
+			}
+		case stateOption:
+			t.handleOption(t.command, b)
+			t.state = stateData
+		case stateSubnegotiation:
+			if b == telnetIAC {
+				t.state = stateSubnegotiationIAC
+			} else {
+				t.addSubnegotiation(b)
+			}
+		case stateSubnegotiationIAC:
+			switch b {
+			case telnetSE:
+				t.handleSubnegotiation(t.subnegotiation)
+				t.state = stateData
+			case telnetIAC:
+				t.state = stateSubnegotiation
+				t.addSubnegotiation(b)
+			default:
+				// broken subnegotiation, drop it
+				t.state = stateData
+			}
+		}
+	}
+	return n
+}
+
+func (t *Telnet) addSubnegotiation(b byte) {
+	if len(t.subnegotiation) >= maxSubnegotiation {
+		// too long, drop it
+		t.subnegotiation = t.subnegotiation[:0]
+		t.state = stateData
+		return
+	}
+	t.subnegotiation = append(t.subnegotiation, b)
+}
+
+func (t *Telnet) handleOption(command, option byte) {
+	switch command {
+	case telnetDO:
+		if !supportedLocalOptions[option] {
+			t.send(telnetWONT, option)
+		} else if !t.local[option] {
+			t.local[option] = true
+			if !t.pendingLocal[option] {
+				t.send(telnetWILL, option)
+			}
+		}
+		delete(t.pendingLocal, option)
+	case telnetDONT:
+		if t.local[option] {
+			t.local[option] = false
+			if !t.pendingLocal[option] {
+				t.send(telnetWONT, option)
+			}
+		}
+		delete(t.pendingLocal, option)
+	case telnetWILL:
+		if !supportedRemoteOptions[option] {
+			t.send(telnetDONT, option)
+		} else if !t.remote[option] {
+			t.remote[option] = true
+			if !t.pendingRemote[option] {
+				t.send(telnetDO, option)
+			}
+			if option == optionTTYPE {
+				t.send(telnetSB, optionTTYPE, ttypeSend, telnetIAC, telnetSE)
+			}
+		}
+		delete(t.pendingRemote, option)
+	case telnetWONT:
+		if t.remote[option] {
+			t.remote[option] = false
+			if !t.pendingRemote[option] {
+				t.send(telnetDONT, option)
+			}
+		}
+		delete(t.pendingRemote, option)
+	}
+	t.updateOptions()
+}
+
+func (t *Telnet) handleSubnegotiation(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	switch data[0] {
+	case optionNAWS:
+		if len(data) == 5 {
+			t.options.Width = int(data[1])<<8 | int(data[2])
+			t.options.Height = int(data[3])<<8 | int(data[4])
+		}
+	case optionTTYPE:
+		if len(data) > 1 && data[1] == ttypeIs {
+			t.options.TerminalType = string(data[2:])
+		}
+	case optionGMCP:
+		t.handleGMCP(data[1:])
+	}
+}
+
+// handleGMCP reads the message from the client. It's the name of the
+// message and optionally the JSON data after a space.
+func (t *Telnet) handleGMCP(message []byte) {
+	name, data := string(message), ""
+	if i := strings.IndexByte(name, ' '); i >= 0 {
+		name, data = name[:i], strings.TrimSpace(name[i+1:])
+	}
+
+	// the names are case insensitive
+	switch strings.ToLower(name) {
+	case "core.hello":
+		var hello struct {
+			Client  string `json:"client"`
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal([]byte(data), &hello); err != nil {
+			fmt.Printf("Invalid GMCP Core.Hello: %v\n", err)
+			return
+		}
+		t.options.ClientName = hello.Client
+		t.options.ClientVersion = hello.Version
+	case "core.ping":
+		if t.options.GMCP {
+			t.sendGMCP("Core.Ping", nil)
+		}
+	}
+}
+
+func (t *Telnet) requestLocal(option byte, enable bool) {
+	if t.local[option] == enable {
+		return
+	}
+	t.local[option] = enable
+	t.pendingLocal[option] = true
+	if enable {
+		t.send(telnetWILL, option)
+	} else {
+		t.send(telnetWONT, option)
+	}
+	t.updateOptions()
+}
+
+func (t *Telnet) requestRemote(option byte, enable bool) {
+	if t.remote[option] == enable {
+		return
+	}
+	t.pendingRemote[option] = true
+	if enable {
+		t.send(telnetDO, option)
+	} else {
+		t.send(telnetDONT, option)
+	}
+}
+
+func (t *Telnet) updateOptions() {
+	t.options.Echo = t.local[optionEcho]
+	t.options.SuppressGoAhead = t.local[optionSGA]
+	t.options.NAWS = t.remote[optionNAWS]
+	t.options.TTYPE = t.remote[optionTTYPE]
+	// GMCP isn't sent before the client has agreed to it
+	t.options.GMCP = t.local[optionGMCP] && !t.pendingLocal[optionGMCP]
+}
+
+// send queues the command to be written on the next flush
+func (t *Telnet) send(bytes ...byte) {
+	t.output = append(t.output, telnetIAC)
+	t.output = append(t.output, bytes...)
+}
+
+// sendGMCP queues the GMCP message with the data, if any
+func (t *Telnet) sendGMCP(name string, data []byte) {
+	message := []byte(name)
+	if data != nil {
+		message = append(append(message, ' '), data...)
+	}
+	t.send(telnetSB, optionGMCP)
+	t.output = append(t.output, bytes.ReplaceAll(message, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC})...)
+	t.send(telnetSE)
+}
+
+func (t *Telnet) flush() error {
+	if len(t.output) == 0 {
+		return nil
+	}
+	_, err := t.writer.Write(t.output)
+	t.output = t.output[:0]
+	return err
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mkauppila/mud/internal/game"
+)
+
+func decodeAll(t *testing.T, input []byte) (string, []byte, *Telnet) {
+	t.Helper()
+	var output bytes.Buffer
+	telnet := NewTelnet(iotest.OneByteReader(bytes.NewReader(input)), &output)
+	data, err := io.ReadAll(telnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), output.Bytes(), telnet
+}
+
+func TestTelnetStripsCommands(t *testing.T) {
+	testCases := []struct {
+		input []byte
+		want  string
+	}{
+		{input: []byte("look\r\n"), want: "look\r\n"},
+		{input: []byte("lo\xff\xf1ok\r\n"), want: "look\r\n"},
+		{input: []byte("\xff\xfd\x03say hi\r\x00\n"), want: "say hi\r\n"},
+		{input: []byte("say \xff\xff\n"), want: "say \xff\n"},
+		{input: []byte("\xff\xfa\x1f\x00\x50\x00\x18\xff\xf0look\n"), want: "look\n"},
+	}
+
+	for i, tc := range testCases {
+		data, _, _ := decodeAll(t, tc.input)
+		if data != tc.want {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, data, tc.want)
+		}
+	}
+}
+
+func TestTelnetDropsTooLongSubnegotiation(t *testing.T) {
+	input := []byte("\xff\xfa\x1f")
+	input = append(input, bytes.Repeat([]byte("a"), maxSubnegotiation)...)
+	input = append(input, "look\n"...)
+
+	data, _, telnet := decodeAll(t, input)
+	if data != "look\n" {
+		t.Fatalf("Got %q, expected the subnegotiation to be dropped", data)
+	}
+	if len(telnet.subnegotiation) != 0 {
+		t.Fatalf("Got %d bytes, expected the buffer to be emptied", len(telnet.subnegotiation))
+	}
+}
+
+func TestTelnetAnswersNegotiation(t *testing.T) {
+	testCases := []struct {
+		input []byte
+		want  []byte
+	}{
+		// unsupported options are refused
+		{input: []byte{telnetIAC, telnetDO, 42}, want: []byte{telnetIAC, telnetWONT, 42}},
+		{input: []byte{telnetIAC, telnetWILL, 42}, want: []byte{telnetIAC, telnetDONT, 42}},
+		// supported options are agreed to
+		{input: []byte{telnetIAC, telnetDO, optionSGA}, want: []byte{telnetIAC, telnetWILL, optionSGA}},
+		{input: []byte{telnetIAC, telnetWILL, optionNAWS}, want: []byte{telnetIAC, telnetDO, optionNAWS}},
+		// terminal type is asked for as soon as the client agrees to send it
+		{
+			input: []byte{telnetIAC, telnetWILL, optionTTYPE},
+			want: []byte{
+				telnetIAC, telnetDO, optionTTYPE,
+				telnetIAC, telnetSB, optionTTYPE, ttypeSend, telnetIAC, telnetSE,
+			},
+		},
+		// disabling options that are not enabled needs no answer
+		{input: []byte{telnetIAC, telnetDONT, optionEcho}, want: nil},
+		{input: []byte{telnetIAC, telnetWONT, optionNAWS}, want: nil},
+	}
+
+	for i, tc := range testCases {
+		_, output, _ := decodeAll(t, tc.input)
+		if !bytes.Equal(output, tc.want) {
+			t.Fatalf("Testcase %d: Got %v, expected %v", i, output, tc.want)
+		}
+	}
+}
+
+func TestTelnetNegotiationWithClient(t *testing.T) {
+	// recorded answers of a client to the server's negotiation
+	input := []byte(
+		"\xff\xfd\x03" + // DO SGA
+			"\xff\xfb\x1f" + // WILL NAWS
+			"\xff\xfb\x18" + // WILL TTYPE
+			"\xff\xfa\x1f\x00\x78\x00\x28\xff\xf0" + // NAWS 120x40
+			"\xff\xfa\x18\x00xterm-256color\xff\xf0" + // TTYPE IS
+			"look\r\n",
+	)
+
+	var output bytes.Buffer
+	telnet := NewTelnet(bytes.NewReader(input), &output)
+	if err := telnet.Negotiate(); err != nil {
+		t.Fatal(err)
+	}
+	negotiation := []byte{
+		telnetIAC, telnetWILL, optionSGA,
+		telnetIAC, telnetDO, optionNAWS,
+		telnetIAC, telnetDO, optionTTYPE,
+		telnetIAC, telnetWILL, optionGMCP,
+	}
+	if !bytes.Equal(output.Bytes(), negotiation) {
+		t.Fatalf("Got %v, expected %v", output.Bytes(), negotiation)
+	}
+	output.Reset()
+
+	data, err := io.ReadAll(telnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "look\r\n" {
+		t.Fatalf("Got %q, expected look", data)
+	}
+
+	ttypeSendRequest := []byte{telnetIAC, telnetSB, optionTTYPE, ttypeSend, telnetIAC, telnetSE}
+	if !bytes.Equal(output.Bytes(), ttypeSendRequest) {
+		t.Fatalf("only the terminal type should be requested, got %v", output.Bytes())
+	}
+
+	options := telnet.Options()
+	if !options.SuppressGoAhead || !options.NAWS || !options.TTYPE {
+		t.Fatalf("options should be enabled: %+v", options)
+	}
+	if width, height := telnet.WindowSize(); width != 120 || height != 40 {
+		t.Fatalf("Got window size %dx%d, expected 120x40", width, height)
+	}
+	if telnet.TerminalType() != "xterm-256color" {
+		t.Fatalf("Got terminal type %s", telnet.TerminalType())
+	}
+}
+
+func TestTelnetSuppressEcho(t *testing.T) {
+	var output bytes.Buffer
+	telnet := NewTelnet(bytes.NewReader([]byte{telnetIAC, telnetDO, optionEcho}), &output)
+
+	telnet.SuppressEcho(true)
+	if !bytes.Equal(output.Bytes(), []byte{telnetIAC, telnetWILL, optionEcho}) {
+		t.Fatalf("Got %v, expected WILL ECHO", output.Bytes())
+	}
+	output.Reset()
+
+	// the client agreeing is not answered again
+	io.ReadAll(telnet)
+	if output.Len() != 0 {
+		t.Fatalf("Got %v, expected no answer", output.Bytes())
+	}
+	if !telnet.Options().Echo {
+		t.Fatal("echo should be enabled on the server")
+	}
+
+	telnet.SuppressEcho(false)
+	if !bytes.Equal(output.Bytes(), []byte{telnetIAC, telnetWONT, optionEcho}) {
+		t.Fatalf("Got %v, expected WONT ECHO", output.Bytes())
+	}
+	if telnet.Options().Echo {
+		t.Fatal("echo should be disabled on the server")
+	}
+}
+
+func gmcpMessage(message string) []byte {
+	return append(append([]byte{telnetIAC, telnetSB, optionGMCP}, message...), telnetIAC, telnetSE)
+}
+
+func TestTelnetSendsEventsAsGMCP(t *testing.T) {
+	input := append([]byte{telnetIAC, telnetDO, optionGMCP}, gmcpMessage(`Core.Hello {"client": "Mudlet", "version": "4.17"}`)...)
+	var output bytes.Buffer
+	telnet := NewTelnet(bytes.NewReader(input), &output)
+
+	// nothing is sent before the client has agreed to GMCP
+	telnet.Negotiate()
+	telnet.SendEvent(game.CharVitals{Health: 10, MaxHealth: 30})
+	output.Reset()
+
+	io.ReadAll(telnet)
+	options := telnet.Options()
+	if !options.GMCP || options.ClientName != "Mudlet" || options.ClientVersion != "4.17" {
+		t.Fatalf("Got %+v, expected GMCP from Mudlet 4.17", options)
+	}
+
+	testCases := []struct {
+		event game.Event
+		want  string
+	}{
+		{event: game.CharVitals{Health: 10, MaxHealth: 30}, want: `Char.Vitals {"hp":10,"maxhp":30}`},
+		{
+			event: game.RoomInfo{Id: "square", Name: "Square", Area: "town", Exits: map[string]game.RoomId{"north": "gate"}},
+			want:  `Room.Info {"num":"square","name":"Square","area":"town","exits":{"north":"gate"}}`,
+		},
+		{
+			event: game.CharStatus{Name: "Abel", State: "fighting", Opponent: "rat"},
+			want:  `Char.Status {"name":"Abel","state":"fighting","experience":0,"opponent":"rat"}`,
+		},
+	}
+	for i, tc := range testCases {
+		output.Reset()
+		telnet.SendEvent(tc.event)
+		if want := gmcpMessage(tc.want); !bytes.Equal(output.Bytes(), want) {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, output.Bytes(), want)
+		}
+	}
+}
+
+func TestTelnetGMCPRefused(t *testing.T) {
+	var output bytes.Buffer
+	telnet := NewTelnet(bytes.NewReader([]byte{telnetIAC, telnetDONT, optionGMCP}), &output)
+	telnet.Negotiate()
+	io.ReadAll(telnet)
+	output.Reset()
+
+	telnet.SendEvent(game.CharVitals{Health: 10, MaxHealth: 30})
+	if output.Len() != 0 || telnet.Options().GMCP {
+		t.Fatalf("Got %q, expected no GMCP", output.Bytes())
+	}
+}
+
+func TestTelnetAnswersGMCPPing(t *testing.T) {
+	input := append([]byte{telnetIAC, telnetDO, optionGMCP}, gmcpMessage("Core.Ping")...)
+	_, output, _ := decodeAll(t, input)
+
+	want := append([]byte{telnetIAC, telnetWILL, optionGMCP}, gmcpMessage("Core.Ping")...)
+	if !bytes.Equal(output, want) {
+		t.Fatalf("Got %q, expected %q", output, want)
+	}
+}
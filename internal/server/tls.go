@@ -0,0 +1,101 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// LoadTLSConfig reads the certificate and its key from PEM files
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// SelfSignedTLSConfig generates a certificate for the hosts for development.
+// The clients have to be told to trust it.
+func SelfSignedTLSConfig(hosts ...string) (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"MUD development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+			Leaf:        leaf,
+		}},
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// StartTLSListener accepts telnet over TLS at the address next to the
+// plain listener
+func (s *Server) StartTLSListener(address string, config *tls.Config) {
+	fmt.Printf("starting TLS at %s\n", address)
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		panic(err)
+	}
+	s.ServeTLS(ln, config)
+}
+
+// ServeTLS accepts the TLS connections from the listener until the server
+// is shut down. The clients join the same world as the plain ones.
+func (s *Server) ServeTLS(ln net.Listener, config *tls.Config) {
+	tlsListener := tls.NewListener(ln, config)
+	defer tlsListener.Close()
+
+	if !s.addListener(tlsListener) {
+		return
+	}
+	s.acceptConnections(tlsListener, s.addAcceptedClient)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mkauppila/mud/internal/game"
+)
+
+func TestTLSClientsShareTheWorld(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	config, err := SelfSignedTLSConfig("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id ClientId = "secure"
+	server := NewServer(fixedIdGenerator(id), world)
+	server.shutdownCountdown = 0
+	served := make(chan struct{})
+	go func() {
+		server.ServeTLS(ln, config)
+		close(served)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(config.Certificates[0].Leaf)
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: roots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	login(t, conn, bufio.NewReader(conn), "abel")
+
+	if !hasCharacter(world, id) {
+		t.Fatal("the TLS client should be playing")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the TLS listener should be closed on shutdown")
+	}
+}
+
+func TestTLSRefusesUntrustedClients(t *testing.T) {
+	config, err := SelfSignedTLSConfig("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	server := NewServer(fixedIdGenerator("secure"), blockingWorld{})
+	go server.ServeTLS(ln, config)
+
+	// the certificate isn't trusted without the root
+	if conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{}); err == nil {
+		conn.Close()
+		t.Fatal("the self-signed certificate should not be trusted by default")
+	}
+}
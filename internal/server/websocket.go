@@ -0,0 +1,379 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mkauppila/mud/internal/game"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// webSocketGUID is appended to the client's key in the handshake (RFC 6455)
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	closeNormal         = 1000
+	closeProtocolError  = 1002
+	closeMessageTooBig  = 1009
+	maxWebSocketMessage = 4096
+)
+
+// webSocketControl marks the start and the end of a control message in the
+// output. It's never a part of UTF-8 text. The control messages are sent as
+// binary frames and the rest as text frames.
+const webSocketControl = "\xff"
+
+// ErrWebSocketProtocol closes the connection with the code
+type ErrWebSocketProtocol struct {
+	code   uint16
+	reason string
+}
+
+func (e ErrWebSocketProtocol) Error() string {
+	return fmt.Sprintf("websocket protocol error: %s", e.reason)
+}
+
+// WebHandler serves the web client at / and the WebSocket at /ws
+func (s *Server) WebHandler() http.Handler {
+	mux := http.NewServeMux()
+	files, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	mux.HandleFunc("/ws", s.serveWebSocket)
+	return mux
+}
+
+// StartWebServer serves the web client and the WebSocket at the address
+func (s *Server) StartWebServer(address string) {
+	fmt.Printf("starting the web client at %s\n", address)
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		panic(err)
+	}
+	defer ln.Close()
+
+	if !s.addListener(ln) {
+		return
+	}
+	err = http.Serve(ln, s.WebHandler())
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		fmt.Printf("Web server failed: %v\n", err)
+	}
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		key == "" {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	if !s.originAllowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket is not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		fmt.Printf("Failed to hijack the WebSocket connection: %v\n", err)
+		return
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		fmt.Printf("Failed to answer the WebSocket handshake: %v\n", err)
+		conn.Close()
+		return
+	}
+
+	ws := newWebSocketConn(conn, rw.Reader)
+	if err := s.addClient(ws, NewWebSocketClient); err != nil {
+		fmt.Printf("Failed to add a WebSocket client: %v\n", err)
+		var full ErrServerFull
+		if errors.As(err, &full) {
+			ws.Write([]byte(serverFullMessage))
+		}
+		ws.Close()
+	}
+}
+
+// originAllowed tells if the page opening the WebSocket may use it. Other
+// clients than browsers send no origin.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func webSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// NewWebSocketClient creates a client for a WebSocket connection. Every text
+// frame is a line of input and every message is sent as a text frame.
+func NewWebSocketClient(conn net.Conn, id ClientId, world game.Worlder, options OutputOptions) *Client {
+	client := newClient(conn, id, world, options)
+	client.terminal = webSocketTerminal{reader: conn, output: queueWriter{client.output}}
+	return client
+}
+
+// webSocketTerminal has none of the telnet options, the browser takes care
+// of the size. The echo is controlled with the control messages.
+type webSocketTerminal struct {
+	reader io.Reader
+	// output is the client's output queue which keeps the control messages
+	// in order with the text
+	output io.Writer
+}
+
+type webSocketEcho struct {
+	Echo bool `json:"echo"`
+}
+
+func (t webSocketTerminal) Read(p []byte) (int, error) { return t.reader.Read(p) }
+func (t webSocketTerminal) Negotiate() error           { return nil }
+
+// SuppressEcho tells the web client to hide the input, e.g. for passwords
+func (t webSocketTerminal) SuppressEcho(suppress bool) {
+	message, err := json.Marshal(webSocketEcho{Echo: !suppress})
+	if err != nil {
+		panic(err)
+	}
+	t.output.Write([]byte(webSocketControl + string(message) + webSocketControl))
+}
+
+func (t webSocketTerminal) WindowSize() (width, height int) { return 0, 0 }
+func (t webSocketTerminal) TerminalType() string            { return "websocket" }
+func (t webSocketTerminal) SendEvent(game.Event)            {}
+
+// webSocketConn reads and writes the WebSocket frames over the hijacked
+// connection. The addresses and deadlines are the connection's own.
+type webSocketConn struct {
+	net.Conn
+	reader *bufio.Reader
+	// input is what's left of the message being read
+	input      []byte
+	writeMutex sync.Mutex
+}
+
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader) *webSocketConn {
+	return &webSocketConn{Conn: conn, reader: reader}
+}
+
+// Read returns the text messages each ending in a newline
+func (c *webSocketConn) Read(p []byte) (int, error) {
+	for len(c.input) == 0 {
+		message, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if !strings.HasSuffix(string(message), "\n") {
+			message = append(message, '\n')
+		}
+		c.input = message
+	}
+	n := copy(p, c.input)
+	c.input = c.input[n:]
+	return n, nil
+}
+
+func (c *webSocketConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			var protocolErr ErrWebSocketProtocol
+			if errors.As(err, &protocolErr) {
+				c.writeClose(protocolErr.code)
+			}
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			c.writeFrame(opPong, payload)
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeClose(closeNormal)
+			return nil, io.EOF
+		}
+
+		message = append(message, payload...)
+		if len(message) > maxWebSocketMessage {
+			c.writeClose(closeMessageTooBig)
+			return nil, ErrWebSocketProtocol{code: closeMessageTooBig, reason: "message too big"}
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *webSocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	if !masked {
+		return false, 0, nil, ErrWebSocketProtocol{code: closeProtocolError, reason: "unmasked frame from the client"}
+	}
+	switch opcode {
+	case opContinuation, opText, opBinary:
+	case opClose, opPing, opPong:
+		if !fin || length > 125 {
+			return false, 0, nil, ErrWebSocketProtocol{code: closeProtocolError, reason: "invalid control frame"}
+		}
+	default:
+		return false, 0, nil, ErrWebSocketProtocol{code: closeProtocolError, reason: fmt.Sprintf("unknown opcode %d", opcode)}
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, ErrWebSocketProtocol{code: closeMessageTooBig, reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Write sends the text as one text frame and each control message in it as
+// a binary frame
+func (c *webSocketConn) Write(p []byte) (int, error) {
+	for i, part := range strings.Split(string(p), webSocketControl) {
+		opcode := byte(opText)
+		if i%2 == 1 {
+			opcode = opBinary
+		} else if part == "" {
+			continue
+		}
+		if err := c.writeFrame(opcode, []byte(part)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if _, err := c.Conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *webSocketConn) writeClose(code uint16) {
+	var payload [2]byte
+	binary.BigEndian.PutUint16(payload[:], code)
+	c.writeFrame(opClose, payload[:])
+}
+
+// Close closes the connection right away. The close frame isn't sent as a
+// slow client could block it.
+func (c *webSocketConn) Close() error {
+	return c.Conn.Close()
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkauppila/mud/internal/game"
+)
+
+// upgradeWebSocket sends the upgrade request from a page of the origin, or
+// from a client which isn't a browser if the origin is empty
+func upgradeWebSocket(t *testing.T, url, origin string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	request := "GET /ws HTTP/1.1\r\nHost: mud\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n"
+	if origin != "" {
+		request += "Origin: " + origin + "\r\n"
+	}
+	if _, err := conn.Write([]byte(request + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, response
+}
+
+// dialWebSocket does the client's side of the handshake
+func dialWebSocket(t *testing.T, url string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, reader, response := upgradeWebSocket(t, url, "")
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Got status %d, expected the protocol to be switched", response.StatusCode)
+	}
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Got accept %q", accept)
+	}
+	return conn, reader
+}
+
+// sendFrame sends a masked frame like the browsers do
+func sendFrame(t *testing.T, conn net.Conn, opcode byte, payload string) {
+	t.Helper()
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, string) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatal("frames from the server should not be masked")
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var extended [2]byte
+		io.ReadFull(reader, extended[:])
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, string(payload)
+}
+
+// readTextUntil reads the text frames until the text and returns the
+// control messages read on the way
+func readTextUntil(t *testing.T, reader *bufio.Reader, want string) []string {
+	t.Helper()
+	var read string
+	var controls []string
+	for !strings.Contains(read, want) {
+		opcode, payload := readFrame(t, reader)
+		switch opcode {
+		case opText:
+			read += payload
+		case opBinary:
+			controls = append(controls, payload)
+		default:
+			t.Fatalf("Got opcode %d while waiting for %q", opcode, want)
+		}
+	}
+	return controls
+}
+
+func TestWebSocketClientPlays(t *testing.T) {
+	world := game.NewWorld()
+	go world.RunGameLoop()
+	defer world.Stop()
+
+	var id ClientId = "browser"
+	server := NewServer(fixedIdGenerator(id), world)
+	httpServer := httptest.NewServer(server.WebHandler())
+	defer httpServer.Close()
+
+	conn, reader := dialWebSocket(t, httpServer.URL)
+	defer conn.Close()
+	readTextUntil(t, reader, "What's your account name?")
+
+	echoOff, echoOn := `{"echo":false}`, `{"echo":true}`
+	for i, step := range []struct {
+		input, want string
+		controls    []string
+	}{
+		{"abel", "Pick a password", []string{echoOff}},
+		{"secret", "Confirm the password", nil},
+		{"secret", "Name your first character", []string{echoOn}},
+		{"abel", "You look around", nil},
+		{"say hello", "You said hello", nil},
+	} {
+		sendFrame(t, conn, opText, step.input)
+		controls := readTextUntil(t, reader, step.want)
+		if !reflect.DeepEqual(controls, step.controls) {
+			t.Fatalf("Testcase %d: Got %q, expected %q", i, controls, step.controls)
+		}
+	}
+
+	sendFrame(t, conn, opPing, "ping")
+	if opcode, payload := readFrame(t, reader); opcode != opPong || payload != "ping" {
+		t.Fatalf("Got %d %q, expected a pong", opcode, payload)
+	}
+
+	sendFrame(t, conn, opClose, "")
+	if opcode, _ := readFrame(t, reader); opcode != opClose {
+		t.Fatalf("Got %d, expected the close to be answered", opcode)
+	}
+	waitFor(t, "the client to be removed", func() bool {
+		return server.getClient(id) == nil
+	})
+	if hasCharacter(world, id) {
+		t.Fatal("the character should be removed")
+	}
+}
+
+func TestWebSocketChecksTheOrigin(t *testing.T) {
+	server := NewServer(fixedIdGenerator("browser"), blockingWorld{}, WithAllowedOrigins("https://example.com"))
+	httpServer := httptest.NewServer(server.WebHandler())
+	defer httpServer.Close()
+
+	testCases := []struct {
+		origin string
+		status int
+	}{
+		{origin: "", status: http.StatusSwitchingProtocols},
+		{origin: "http://mud", status: http.StatusSwitchingProtocols},
+		{origin: "https://example.com", status: http.StatusSwitchingProtocols},
+		{origin: "https://evil.example", status: http.StatusForbidden},
+		{origin: "null", status: http.StatusForbidden},
+	}
+	for i, tc := range testCases {
+		conn, _, response := upgradeWebSocket(t, httpServer.URL, tc.origin)
+		conn.Close()
+		if response.StatusCode != tc.status {
+			t.Fatalf("Testcase %d: Got %d, expected %d", i, response.StatusCode, tc.status)
+		}
+	}
+}
+
+func TestWebSocketRejectsUnmaskedFrames(t *testing.T) {
+	server := NewServer(fixedIdGenerator("browser"), blockingWorld{})
+	httpServer := httptest.NewServer(server.WebHandler())
+	defer httpServer.Close()
+
+	conn, reader := dialWebSocket(t, httpServer.URL)
+	defer conn.Close()
+	conn.Write([]byte{0x81, 0x04, 'l', 'o', 'o', 'k'})
+
+	opcode, payload := readFrame(t, reader)
+	if opcode != opClose || binary.BigEndian.Uint16([]byte(payload)) != closeProtocolError {
+		t.Fatalf("Got %d %q, expected a protocol error", opcode, payload)
+	}
+}
+
+func TestWebClientIsServed(t *testing.T) {
+	server := NewServer(fixedIdGenerator("browser"), blockingWorld{})
+	httpServer := httptest.NewServer(server.WebHandler())
+	defer httpServer.Close()
+
+	response, err := http.Get(httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if !strings.Contains(string(body), "new WebSocket") {
+		t.Fatalf("Got %q, expected the web client", body)
+	}
+
+	response, err = http.Get(httpServer.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Got %d, expected a plain request to /ws to be refused", response.StatusCode)
+	}
+}